@@ -0,0 +1,51 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	propBits       = "bits"
+	propDownsample = "downsample"
+)
+
+// bitcrusher reduces the bit depth and sample rate of its input.
+type bitcrusher struct {
+	*Props
+	bits       *atomic.Value
+	downsample *atomic.Value
+	mix        *atomic.Value
+
+	// state
+	held  [2]float64 // left and right
+	phase int        // samples since the last held sample
+}
+
+func newBitcrusher(props *Props, seq *Sequencer) Effect {
+	return &bitcrusher{
+		Props:      props,
+		bits:       props.MustRegister(propBits, setIntRange(1, 24), 8),
+		downsample: props.MustRegister(propDownsample, setIntRange(1, 64), 1),
+		mix:        props.MustRegister(propMix, setFloat64(0, 1), 1.),
+	}
+}
+
+func (b *bitcrusher) Process(samples [][]float32) {
+	steps := math.Pow(2, float64(b.bits.Load().(int)-1))
+	downsample := b.downsample.Load().(int)
+	mix := b.mix.Load().(float64)
+	for n := range samples[0] {
+		if b.phase%downsample == 0 {
+			for i := range b.held {
+				b.held[i] = math.Round(float64(samples[i][n])*steps) / steps
+			}
+			b.phase = 0
+		}
+		b.phase++
+		for i := range b.held {
+			dry := float64(samples[i][n])
+			samples[i][n] = float32(dry + mix*(b.held[i]-dry))
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+// A Bus mixes the sends of channels, runs them through a chain of effects and
+// returns the result to the master.
+type Bus struct {
+	*Props
+	Chain
+	gain  *atomic.Value
+	bufs  [][]float32
+	meter meter
+}
+
+func newBus() *Bus {
+	props := NewProps()
+	return &Bus{
+		Props: props,
+		Chain: newChain(),
+		gain:  props.MustRegister(PropGain, setGain, 0.),
+		bufs:  [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)},
+	}
+}
+
+// Peak returns the highest level of the return in dBFS since the last call.
+func (b *Bus) Peak() float64 {
+	return b.meter.read()
+}
+
+// reset clears the buffers of the bus for the next n samples.
+func (b *Bus) reset(n int) {
+	b.bufs[0], b.bufs[1] = b.bufs[0][:n], b.bufs[1][:n]
+	for i := range b.bufs {
+		for j := range b.bufs[i] {
+			b.bufs[i][j] = 0
+		}
+	}
+}
+
+// mix runs the effects of the bus and adds the return to samples.
+func (b *Bus) mix(samples [][]float32) {
+	b.process(b.bufs)
+	gain := math.Pow(10, b.gain.Load().(float64)/20)
+	var peak float64
+	for i := range samples {
+		for n := range samples[i] {
+			v := gain * float64(b.bufs[i][n])
+			samples[i][n] += float32(v)
+			peak = math.Max(peak, math.Abs(v))
+		}
+	}
+	b.meter.update(peak)
+}
+
+// send is the amount of a channel that is sent to a bus.
+type send struct {
+	bus  *Bus
+	gain *atomic.Value
+}
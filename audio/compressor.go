@@ -0,0 +1,89 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	propThreshold = "threshold"
+	propRatio     = "ratio"
+	propAttack    = "attack"
+	propRelease   = "release"
+	propKnee      = "knee"
+	propMakeup    = "makeup"
+)
+
+// compressor is a feed-forward compressor with a soft knee. The detector is linked
+// across the channels, so the stereo image doesn't shift. With a sidechain, the
+// detector follows the output of another channel instead of the input, which
+// ducks the input whenever that channel plays.
+type compressor struct {
+	*Props
+	threshold *atomic.Value
+	ratio     *atomic.Value
+	attack    *atomic.Value
+	release   *atomic.Value
+	knee      *atomic.Value
+	makeup    *atomic.Value
+	key       *atomic.Value // *Channel, or nil without a sidechain
+
+	// state
+	reduction float64 // smoothed gain reduction in dB
+}
+
+func newCompressor(props *Props, seq *Sequencer) Effect {
+	c := &compressor{
+		Props:     props,
+		threshold: props.MustRegister(propThreshold, setFloat64(-60, 0), -20.),
+		ratio:     props.MustRegister(propRatio, setFloat64(1, 20), 4.),
+		attack:    props.MustRegister(propAttack, setFloat64(0.0001, 1), 0.01),
+		release:   props.MustRegister(propRelease, setFloat64(0.001, 5), 0.1),
+		knee:      props.MustRegister(propKnee, setFloat64(0, 24), 6.),
+		makeup:    props.MustRegister(propMakeup, setFloat64(0, 24), 0.),
+		key:       &atomic.Value{},
+	}
+	c.key.Store((*Channel)(nil))
+	return c
+}
+
+func (c *compressor) Process(samples [][]float32) {
+	threshold := c.threshold.Load().(float64)
+	ratio := c.ratio.Load().(float64)
+	knee := c.knee.Load().(float64)
+	makeup := c.makeup.Load().(float64)
+	attack := math.Exp(-1 / (c.attack.Load().(float64) * sampleRate))
+	release := math.Exp(-1 / (c.release.Load().(float64) * sampleRate))
+	detect := samples
+	if key := c.key.Load().(*Channel); key != nil {
+		detect = key.dry
+	}
+	for n := range samples[0] {
+		peak := math.Max(math.Abs(float64(detect[0][n])), math.Abs(float64(detect[1][n])))
+		level := 20 * math.Log10(math.Max(peak, 1e-9))
+		target := level - compress(level, threshold, ratio, knee)
+		coeff := release
+		if target > c.reduction {
+			coeff = attack
+		}
+		c.reduction = coeff*c.reduction + (1-coeff)*target
+		gain := float32(math.Pow(10, (makeup-c.reduction)/20))
+		samples[0][n] *= gain
+		samples[1][n] *= gain
+	}
+}
+
+// compress returns the output level in dB for an input level, with a knee of the
+// given width around the threshold.
+func compress(level, threshold, ratio, knee float64) float64 {
+	over := level - threshold
+	switch {
+	case 2*over <= -knee:
+		return level
+	case 2*over >= knee:
+		return threshold + over/ratio
+	default:
+		d := over + knee/2
+		return level + (1/ratio-1)*d*d/(2*knee)
+	}
+}
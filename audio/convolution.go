@@ -0,0 +1,209 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sync/atomic"
+)
+
+const (
+	propIR = "ir"
+
+	// convBlock is the length of the partitions of the impulse response. The
+	// output, dry and wet, is delayed by one partition.
+	convBlock = bufferSize
+	convFFT   = 2 * convBlock
+	maxIR     = 3 // seconds
+)
+
+// convolution is a reverb that convolves its input with an impulse response. It
+// uses uniformly partitioned convolution in the frequency domain: the FFTs per
+// block are fixed, but every block multiplies and sums the spectra of all
+// partitions, so the cost grows linearly with the length of the impulse response.
+// A 3 second response has about 260 partitions and takes roughly 0.9 ms per block,
+// close to a tenth of the time a block of audio lasts, for each instance.
+type convolution struct {
+	*Props
+	ir  *atomic.Value // *convolver, or nil without an impulse response
+	mix *atomic.Value
+}
+
+func newConvolution(props *Props, seq *Sequencer) Effect {
+	return &convolution{
+		Props: props,
+		ir:    props.MustRegister(propIR, setImpulseResponse, ""),
+		mix:   props.MustRegister(propMix, setFloat64(0, 1), 0.3),
+	}
+}
+
+func (c *convolution) Process(samples [][]float32) {
+	conv := c.ir.Load().(*convolver)
+	if conv == nil {
+		return
+	}
+	mix := c.mix.Load().(float64)
+	for n := range samples[0] {
+		for i := range samples {
+			// The wet signal lags a block behind, so the dry signal is taken
+			// from the previous block to line up with it
+			dry := conv.in[i][conv.fill]
+			conv.in[i][convBlock+conv.fill] = float64(samples[i][n])
+			wet := conv.out[i][conv.fill]
+			samples[i][n] = float32(dry + mix*(wet-dry))
+		}
+		if conv.fill++; conv.fill == convBlock {
+			conv.process()
+			conv.fill = 0
+		}
+	}
+}
+
+// Get returns the file name of the impulse response for propIR, instead of the
+// convolver that is stored.
+func (c *convolution) Get(key string) (interface{}, error) {
+	if key != propIR {
+		return c.Props.Get(key)
+	}
+	if conv := c.ir.Load().(*convolver); conv != nil {
+		return conv.file, nil
+	}
+	return "", nil
+}
+
+// convolver holds the spectra of the partitions of an impulse response, and the
+// state of a convolution with it. A new convolver is loaded for every change of
+// the impulse response, so the audio thread doesn't have to allocate.
+type convolver struct {
+	file string
+	ir   [2][][]complex128 // spectra of the partitions, for left and right
+
+	// state
+	in   [2][]float64      // the previous and the current block of input
+	out  [2][]float64      // output of the previous block
+	fill int               // samples in the current block
+	fdl  [2][][]complex128 // spectra of past input blocks, a ring buffer
+	head int               // position of the latest block in fdl
+	x    []complex128      // scratch space for transforms
+	acc  []complex128      // sum of the products of the spectra
+}
+
+func loadConvolver(file string) (*convolver, error) {
+	snd, err := LoadSound(file)
+	if err != nil {
+		return nil, err
+	}
+	if snd.len() == 0 {
+		return nil, fmt.Errorf("impulse response is empty: %s", file)
+	}
+	if float64(snd.len())/snd.sampleRate > maxIR {
+		return nil, fmt.Errorf("impulse response is longer than %d seconds: %s", maxIR, file)
+	}
+	bufs := [2][]float64{resample(snd.bufs[0], snd.sampleRate), resample(snd.bufs[1], snd.sampleRate)}
+
+	// Normalize to unity gain for white noise in the louder channel
+	var norm float64
+	for _, buf := range bufs {
+		var energy float64
+		for _, v := range buf {
+			energy += v * v
+		}
+		norm = math.Max(norm, math.Sqrt(energy))
+	}
+	if norm == 0 {
+		return nil, fmt.Errorf("impulse response is silent: %s", file)
+	}
+
+	partitions := (len(bufs[0]) + convBlock - 1) / convBlock
+	conv := &convolver{
+		file: file,
+		x:    make([]complex128, convFFT),
+		acc:  make([]complex128, convFFT/2+1),
+	}
+	for c, buf := range bufs {
+		for p := 0; p < partitions; p++ {
+			x := make([]complex128, convFFT)
+			for n := 0; n < convBlock && p*convBlock+n < len(buf); n++ {
+				x[n] = complex(buf[p*convBlock+n]/norm, 0)
+			}
+			fft(x)
+			conv.ir[c] = append(conv.ir[c], x[:convFFT/2+1])
+		}
+		conv.in[c] = make([]float64, convFFT)
+		conv.out[c] = make([]float64, convBlock)
+		conv.fdl[c] = make([][]complex128, partitions)
+		for p := range conv.fdl[c] {
+			conv.fdl[c][p] = make([]complex128, convFFT/2+1)
+		}
+	}
+	return conv, nil
+}
+
+// process convolves the last two blocks of input with the impulse response,
+// with the overlap-save method, and keeps the part of the result that isn't
+// affected by circular wrapping.
+func (c *convolver) process() {
+	partitions := len(c.fdl[0])
+	c.head = (c.head + 1) % partitions
+	for i := range c.in {
+		for n, v := range c.in[i] {
+			c.x[n] = complex(v, 0)
+		}
+		fft(c.x)
+		copy(c.fdl[i][c.head], c.x[:convFFT/2+1])
+
+		for k := range c.acc {
+			c.acc[k] = 0
+		}
+		for p := 0; p < partitions; p++ {
+			block := c.fdl[i][(c.head-p+partitions)%partitions]
+			h := c.ir[i][p]
+			for k := range c.acc {
+				c.acc[k] += block[k] * h[k]
+			}
+		}
+		// The input is real, so the spectrum is symmetric
+		copy(c.x, c.acc)
+		for k := 1; k < convFFT/2; k++ {
+			c.x[convFFT-k] = cmplx.Conj(c.acc[k])
+		}
+		ifft(c.x)
+		for n := range c.out[i] {
+			c.out[i][n] = real(c.x[convBlock+n])
+		}
+		copy(c.in[i], c.in[i][convBlock:])
+	}
+}
+
+// resample converts buf from rate to the sample rate of the sink with linear
+// interpolation.
+func resample(buf []float64, rate float64) []float64 {
+	if rate == sampleRate {
+		return buf
+	}
+	step := rate / sampleRate
+	out := make([]float64, int(float64(len(buf))/step))
+	for n := range out {
+		pos := float64(n) * step
+		i := int(pos)
+		out[n] = at(buf, i) + (pos-float64(i))*(at(buf, i+1)-at(buf, i))
+	}
+	return out
+}
+
+func setImpulseResponse(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	if s == "" {
+		dest.Store((*convolver)(nil))
+		return nil
+	}
+	conv, err := loadConvolver(s)
+	if err != nil {
+		return err
+	}
+	dest.Store(conv)
+	return nil
+}
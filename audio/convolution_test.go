@@ -0,0 +1,59 @@
+package audio
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestConvolution(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vibe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// An impulse response over several partitions, with half the level on the right
+	ir := make([]float64, 3*convBlock+100)
+	ir[0], ir[700], ir[len(ir)-1] = 0.8, -0.4, 0.2
+	norm := math.Sqrt(0.8*0.8 + 0.4*0.4 + 0.2*0.2)
+	file := filepath.Join(dir, "ir.wav")
+	wav := wavFile(3, 32, sampleRate, ir, func(v float64) []byte { return le(float32(v)) })
+	if err := ioutil.WriteFile(file, wav, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	effect, _ := NewEffect("convolution", NewProps(), nil)
+	for _, mix := range []float64{1, 0.5} {
+		// Loading the impulse response again clears the state
+		if err := effect.Set(propIR, file); err != nil {
+			t.Fatal(err)
+		}
+		effect.Set(propMix, mix)
+		out := impulseResponse(effect, 5*convBlock)
+		for i, scale := range []float64{1, 0.5} {
+			for n, v := range out[i] {
+				// The dry impulse lines up with the start of the wet signal
+				want := 0.
+				if n == convBlock {
+					want = 1 - mix
+				}
+				if n >= convBlock && n-convBlock < len(ir) {
+					want += mix * scale * ir[n-convBlock] / norm
+				}
+				if math.Abs(v-want) > 1e-6 {
+					t.Fatalf("mix %v, channel %d, sample %d: want %v, got %v", mix, i, n, want, v)
+				}
+			}
+		}
+	}
+	if got, _ := effect.Get(propIR); got != file {
+		t.Errorf("ir: want %v, got %v", file, got)
+	}
+
+	if err := effect.Set(propIR, filepath.Join(dir, "missing.wav")); err == nil {
+		t.Error("expected an error for a missing file")
+	}
+}
@@ -0,0 +1,290 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+
+	"github.com/jfreymuth/oggvorbis"
+)
+
+var errNoAudio = errors.New("file contains no audio data")
+
+// LoadSound decodes a wav, aiff, flac or ogg vorbis file. The format is detected
+// from the contents of the file, not its name.
+func LoadSound(file string) (*Sound, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	snd := &Sound{file: file, loop: loopOff}
+	switch {
+	case hasMagic(data, 0, "RIFF") && hasMagic(data, 8, "WAVE"):
+		err = decodeWAV(data, snd)
+	case hasMagic(data, 0, "FORM") && (hasMagic(data, 8, "AIFF") || hasMagic(data, 8, "AIFC")):
+		err = decodeAIFF(data, snd)
+	case hasMagic(data, 0, "fLaC"):
+		err = decodeFLAC(data, snd)
+	case hasMagic(data, 0, "OggS"):
+		err = decodeOgg(data, snd)
+	default:
+		return nil, fmt.Errorf("unsupported audio file, expected wav, aiff, flac or ogg: %s", file)
+	}
+	if err == nil && snd.len() == 0 {
+		err = errNoAudio
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", file, err)
+	}
+	return snd, nil
+}
+
+func hasMagic(data []byte, offset int, magic string) bool {
+	return len(data) >= offset+len(magic) && string(data[offset:offset+len(magic)]) == magic
+}
+
+// setChannels stores decoded audio in snd. Mono sounds use the same buffer for
+// both channels, and channels after the first two are dropped.
+func (s *Sound) setChannels(channels [][]float64, rate float64) {
+	s.bufs[0] = channels[0]
+	s.bufs[1] = channels[0]
+	if len(channels) > 1 {
+		s.bufs[1] = channels[1]
+	}
+	s.sampleRate = rate
+}
+
+// pcmFormat describes interleaved, uncompressed samples.
+type pcmFormat struct {
+	channels int
+	bits     int
+	float    bool
+	order    binary.ByteOrder
+	unsigned bool // 8 bit wav files are unsigned
+}
+
+func (f pcmFormat) decode(data []byte) ([][]float64, error) {
+	if f.channels < 1 {
+		return nil, fmt.Errorf("invalid number of channels: %d", f.channels)
+	}
+	size := (f.bits + 7) / 8
+	switch {
+	case f.float && size != 4 && size != 8:
+		return nil, fmt.Errorf("unsupported float sample size: %d bits", f.bits)
+	case !f.float && (size < 1 || size > 4):
+		return nil, fmt.Errorf("unsupported sample size: %d bits", f.bits)
+	}
+	frames := len(data) / (size * f.channels)
+	channels := make([][]float64, f.channels)
+	for c := range channels {
+		channels[c] = make([]float64, frames)
+	}
+	scale := 1 / float64(uint64(1)<<uint(8*size-1))
+	for n := 0; n < frames; n++ {
+		for c := range channels {
+			sample := data[(n*f.channels+c)*size:]
+			switch {
+			case f.float && size == 4:
+				channels[c][n] = float64(math.Float32frombits(f.order.Uint32(sample)))
+			case f.float:
+				channels[c][n] = math.Float64frombits(f.order.Uint64(sample))
+			case size == 1 && f.unsigned:
+				channels[c][n] = (float64(sample[0]) - 128) * scale
+			default:
+				var u uint32
+				for i := 0; i < size; i++ {
+					if f.order == binary.BigEndian {
+						u = u<<8 | uint32(sample[i])
+					} else {
+						u = u<<8 | uint32(sample[size-1-i])
+					}
+				}
+				// Shift the sign bit of the sample into the sign bit of an int32
+				shift := uint(32 - 8*size)
+				channels[c][n] = float64(int32(u<<shift)>>shift) * scale
+			}
+		}
+	}
+	return channels, nil
+}
+
+// riffChunks calls fn for each chunk in a RIFF or IFF file, starting at offset.
+func riffChunks(data []byte, offset int, order binary.ByteOrder, fn func(id string, chunk []byte) error) error {
+	for offset+8 <= len(data) {
+		id := string(data[offset : offset+4])
+		size := int(order.Uint32(data[offset+4:]))
+		offset += 8
+		if size > len(data)-offset {
+			// Some writers don't update the size of the last chunk.
+			size = len(data) - offset
+		}
+		if err := fn(id, data[offset:offset+size]); err != nil {
+			return err
+		}
+		offset += size + size%2
+	}
+	return nil
+}
+
+const (
+	wavFormatPCM        = 1
+	wavFormatFloat      = 3
+	wavFormatExtensible = 0xfffe
+)
+
+func decodeWAV(data []byte, snd *Sound) error {
+	var format pcmFormat
+	var rate float64
+	var samples, smpl []byte
+	err := riffChunks(data, 12, binary.LittleEndian, func(id string, chunk []byte) error {
+		switch id {
+		case "fmt ":
+			if len(chunk) < 16 {
+				return errors.New("invalid fmt chunk")
+			}
+			tag := binary.LittleEndian.Uint16(chunk)
+			if tag == wavFormatExtensible && len(chunk) >= 26 {
+				// The format is in the first two bytes of the sub format GUID
+				tag = binary.LittleEndian.Uint16(chunk[24:])
+			}
+			if tag != wavFormatPCM && tag != wavFormatFloat {
+				return fmt.Errorf("unsupported wav encoding: %#x", tag)
+			}
+			format = pcmFormat{
+				channels: int(binary.LittleEndian.Uint16(chunk[2:])),
+				bits:     int(binary.LittleEndian.Uint16(chunk[14:])),
+				float:    tag == wavFormatFloat,
+				order:    binary.LittleEndian,
+				unsigned: true,
+			}
+			rate = float64(binary.LittleEndian.Uint32(chunk[4:]))
+		case "data":
+			samples = chunk
+		case "smpl":
+			smpl = chunk
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if format.bits == 0 {
+		return errors.New("missing fmt chunk")
+	}
+	if !(rate > 0) {
+		return fmt.Errorf("invalid sample rate: %v", rate)
+	}
+	if samples == nil {
+		return errNoAudio
+	}
+	channels, err := format.decode(samples)
+	if err != nil {
+		return err
+	}
+	snd.setChannels(channels, rate)
+	if smpl != nil {
+		return parseSmplChunk(bytes.NewReader(smpl), snd)
+	}
+	return nil
+}
+
+func decodeAIFF(data []byte, snd *Sound) error {
+	aifc := hasMagic(data, 8, "AIFC")
+	var format pcmFormat
+	var rate float64
+	var samples []byte
+	err := riffChunks(data, 12, binary.BigEndian, func(id string, chunk []byte) error {
+		switch id {
+		case "COMM":
+			if len(chunk) < 18 || aifc && len(chunk) < 22 {
+				return errors.New("invalid COMM chunk")
+			}
+			format = pcmFormat{
+				channels: int(binary.BigEndian.Uint16(chunk)),
+				bits:     int(binary.BigEndian.Uint16(chunk[6:])),
+				order:    binary.BigEndian,
+			}
+			rate = extendedFloat(chunk[8:18])
+			if !aifc {
+				return nil
+			}
+			switch compression := string(chunk[18:22]); compression {
+			case "NONE", "twos":
+			case "sowt":
+				format.order = binary.LittleEndian
+			case "fl32", "FL32":
+				format.float, format.bits = true, 32
+			case "fl64", "FL64":
+				format.float, format.bits = true, 64
+			default:
+				return fmt.Errorf("unsupported aiff compression: %q", compression)
+			}
+		case "SSND":
+			if len(chunk) < 8 {
+				return errors.New("invalid SSND chunk")
+			}
+			offset := int(binary.BigEndian.Uint32(chunk))
+			if 8+offset > len(chunk) {
+				return errors.New("invalid SSND chunk")
+			}
+			samples = chunk[8+offset:]
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if format.bits == 0 {
+		return errors.New("missing COMM chunk")
+	}
+	if !(rate > 0) {
+		return fmt.Errorf("invalid sample rate: %v", rate)
+	}
+	if samples == nil {
+		return errNoAudio
+	}
+	channels, err := format.decode(samples)
+	if err != nil {
+		return err
+	}
+	snd.setChannels(channels, rate)
+	return nil
+}
+
+// extendedFloat decodes the 80 bit extended precision float that aiff files use
+// for the sample rate.
+func extendedFloat(b []byte) float64 {
+	exp := int(binary.BigEndian.Uint16(b) & 0x7fff)
+	mantissa := binary.BigEndian.Uint64(b[2:])
+	val := math.Ldexp(float64(mantissa), exp-16383-63)
+	if b[0]&0x80 != 0 {
+		val = -val
+	}
+	return val
+}
+
+func decodeOgg(data []byte, snd *Sound) error {
+	samples, format, err := oggvorbis.ReadAll(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	if format.Channels < 1 {
+		return fmt.Errorf("invalid number of channels: %d", format.Channels)
+	}
+	if format.SampleRate <= 0 {
+		return fmt.Errorf("invalid sample rate: %d", format.SampleRate)
+	}
+	frames := len(samples) / format.Channels
+	channels := make([][]float64, format.Channels)
+	for c := range channels {
+		channels[c] = make([]float64, frames)
+		for n := range channels[c] {
+			channels[c][n] = float64(samples[n*format.Channels+c])
+		}
+	}
+	snd.setChannels(channels, float64(format.SampleRate))
+	return nil
+}
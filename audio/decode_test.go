@@ -0,0 +1,180 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/mewkiz/flac"
+	"github.com/mewkiz/flac/frame"
+	"github.com/mewkiz/flac/meta"
+)
+
+func TestLoadSound(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vibe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A stereo signal with the right channel at half the level of the left
+	left := []float64{0, 0.5, -0.5, 0.25, -1}
+	tests := []struct {
+		name string
+		data []byte
+		rate float64
+		tol  float64
+	}{
+		{"pcm16.wav", wavFile(1, 16, 44100, left, func(v float64) []byte { return le(int16(v * 32767)) }), 44100, 1e-4},
+		{"pcm24.wav", wavFile(1, 24, 48000, left, func(v float64) []byte { return le(int32(v * 8388607))[:3] }), 48000, 1e-6},
+		{"float32.wav", wavFile(3, 32, 96000, left, func(v float64) []byte { return le(float32(v)) }), 96000, 1e-7},
+		{"pcm16.aiff", aiffFile(22050, left), 22050, 1e-4},
+		{"pcm16.flac", flacFile(32000, left), 32000, 1e-4},
+	}
+	for _, test := range tests {
+		file := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(file, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		snd, err := LoadSound(file)
+		if err != nil {
+			t.Errorf("%s: %v", test.name, err)
+			continue
+		}
+		if snd.sampleRate != test.rate {
+			t.Errorf("%s: wrong sample rate: want %v, got %v", test.name, test.rate, snd.sampleRate)
+		}
+		if snd.len() != len(left) {
+			t.Errorf("%s: wrong length: want %v, got %v", test.name, len(left), snd.len())
+			continue
+		}
+		for n, want := range left {
+			l, r := snd.bufs[0][n], snd.bufs[1][n]
+			if math.Abs(l-want) > test.tol || math.Abs(r-want/2) > test.tol {
+				t.Errorf("%s: sample %d: want %v/%v, got %v/%v", test.name, n, want, want/2, l, r)
+			}
+		}
+	}
+
+	invalid := []struct {
+		name string
+		data []byte
+	}{
+		{"text.wav", []byte("not a sound")},
+		{"rate0.wav", wavFile(1, 16, 0, left, func(v float64) []byte { return le(int16(v * 32767)) })},
+	}
+	for _, test := range invalid {
+		file := filepath.Join(dir, test.name)
+		if err := ioutil.WriteFile(file, test.data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := LoadSound(file); err == nil {
+			t.Errorf("%s: expected an error", test.name)
+		}
+	}
+}
+
+func le(v interface{}) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, v)
+	return buf.Bytes()
+}
+
+// wavFile returns a stereo wav file with left in the left channel and left/2 in
+// the right channel.
+func wavFile(format, bits int, rate uint32, left []float64, encode func(float64) []byte) []byte {
+	var samples bytes.Buffer
+	for _, v := range left {
+		samples.Write(encode(v))
+		samples.Write(encode(v / 2))
+	}
+	var buf bytes.Buffer
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(4+24+8+samples.Len()))
+	buf.WriteString("WAVEfmt ")
+	blockAlign := 2 * bits / 8
+	binary.Write(&buf, binary.LittleEndian, struct {
+		size                 uint32
+		format, channels     uint16
+		rate, byteRate       uint32
+		blockAlign, bitDepth uint16
+	}{16, uint16(format), 2, rate, rate * uint32(blockAlign), uint16(blockAlign), uint16(bits)})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(samples.Len()))
+	buf.Write(samples.Bytes())
+	return buf.Bytes()
+}
+
+func aiffFile(rate float64, left []float64) []byte {
+	var samples bytes.Buffer
+	for _, v := range left {
+		binary.Write(&samples, binary.BigEndian, []int16{int16(v * 32767), int16(v / 2 * 32767)})
+	}
+	// Encode the sample rate as an 80 bit float
+	exp := int(math.Floor(math.Log2(rate)))
+	mantissa := uint64(rate * math.Pow(2, float64(63-exp)))
+
+	var buf bytes.Buffer
+	buf.WriteString("FORM")
+	binary.Write(&buf, binary.BigEndian, uint32(4+26+16+samples.Len()))
+	buf.WriteString("AIFFCOMM")
+	binary.Write(&buf, binary.BigEndian, struct {
+		size     uint32
+		channels uint16
+		frames   uint32
+		bitDepth uint16
+		exp      uint16
+		mantissa uint64
+	}{18, 2, uint32(len(left)), 16, uint16(exp + 16383), mantissa})
+	buf.WriteString("SSND")
+	binary.Write(&buf, binary.BigEndian, []uint32{uint32(8 + samples.Len()), 0, 0})
+	buf.Write(samples.Bytes())
+	return buf.Bytes()
+}
+
+// flacFile returns a flac file with a single mid/side coded frame.
+func flacFile(rate int, left []float64) []byte {
+	l, r := make([]int32, len(left)), make([]int32, len(left))
+	for n, v := range left {
+		l[n], r[n] = int32(v*32767), int32(v/2*32767)
+	}
+	info := &meta.StreamInfo{
+		BlockSizeMin:  16,
+		BlockSizeMax:  16,
+		SampleRate:    uint32(rate),
+		NChannels:     2,
+		BitsPerSample: 16,
+	}
+	var buf bytes.Buffer
+	enc, err := flac.NewEncoder(&buf, info)
+	if err != nil {
+		panic(err)
+	}
+	f := &frame.Frame{
+		Header: frame.Header{
+			HasFixedBlockSize: true,
+			BlockSize:         uint16(len(left)),
+			SampleRate:        uint32(rate),
+			Channels:          frame.ChannelsMidSide,
+			BitsPerSample:     16,
+		},
+	}
+	for _, samples := range [][]int32{l, r} {
+		f.Subframes = append(f.Subframes, &frame.Subframe{
+			SubHeader: frame.SubHeader{Pred: frame.PredVerbatim},
+			Samples:   samples,
+			NSamples:  len(samples),
+		})
+	}
+	if err := enc.WriteFrame(f); err != nil {
+		panic(err)
+	}
+	if err := enc.Close(); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
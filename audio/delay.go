@@ -0,0 +1,174 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+const (
+	propTime     = "time"
+	propFeedback = "feedback"
+	propPingPong = "pingpong"
+	propHighpass = "highpass"
+	propLowpass  = "lowpass"
+
+	maxDelayBeats = 4
+	maxDelay      = 4 // seconds
+	// delayFade is the length in samples of the crossfade to a new delay time
+	// after a change in time or tempo. Jumping through the buffer would click.
+	delayFade = 1024
+)
+
+// delay is a stereo delay with a time in beats, which follows the tempo of the
+// sequencer. The feedback path is filtered, and in ping-pong mode the echoes
+// alternate between left and right.
+type delay struct {
+	*Props
+	seq      *Sequencer
+	time     *atomic.Value
+	feedback *atomic.Value
+	pingPong *atomic.Value
+	highpass *atomic.Value
+	lowpass  *atomic.Value
+	mix      *atomic.Value
+
+	// state
+	bufs    [2][]float64 // left and right
+	pos     int          // write position in bufs
+	length  float64      // current delay in samples
+	next    float64      // delay in samples that is faded to
+	fade    int          // position in the crossfade to next, or -1
+	filters [2][2]biquad // highpass and lowpass for left and right
+}
+
+func newDelay(props *Props, seq *Sequencer) Effect {
+	size := maxDelay*sampleRate + 2
+	return &delay{
+		Props:    props,
+		seq:      seq,
+		time:     props.MustRegister(propTime, setBeats, 0.75),
+		feedback: props.MustRegister(propFeedback, setFloat64(0, 0.99), 0.4),
+		pingPong: props.MustRegister(propPingPong, setBool, false),
+		highpass: props.MustRegister(propHighpass, setFloat64(20, 2000), 100.),
+		lowpass:  props.MustRegister(propLowpass, setFloat64(500, 20_000), 6000.),
+		mix:      props.MustRegister(propMix, setFloat64(0, 1), 0.3),
+		bufs:     [2][]float64{make([]float64, size), make([]float64, size)},
+		length:   -1,
+		fade:     -1,
+	}
+}
+
+func (d *delay) Process(samples [][]float32) {
+	seconds := d.time.Load().(float64) * 60 / d.seq.tempo()
+	target := math.Min(math.Max(seconds*sampleRate, 1), maxDelay*sampleRate)
+	if d.length < 0 {
+		d.length = target
+	}
+	feedback := d.feedback.Load().(float64)
+	pingPong := d.pingPong.Load().(bool)
+	mix := d.mix.Load().(float64)
+	for i := range d.filters {
+		d.filters[i][0].calculateCoefficients("highpass", d.highpass.Load().(float64), math.Sqrt2/2, 0)
+		d.filters[i][1].calculateCoefficients("lowpass", d.lowpass.Load().(float64), math.Sqrt2/2, 0)
+	}
+
+	for n := range samples[0] {
+		if d.fade < 0 && target != d.length {
+			d.next, d.fade = target, 0
+		}
+		wet := d.read(d.length)
+		if d.fade >= 0 {
+			next := d.read(d.next)
+			x := float64(d.fade) / delayFade
+			for c := range wet {
+				wet[c] += x * (next[c] - wet[c])
+			}
+			if d.fade++; d.fade == delayFade {
+				d.length, d.fade = d.next, -1
+			}
+		}
+
+		var echo [2]float64
+		for c := range echo {
+			echo[c] = d.filters[c][1].tick(d.filters[c][0].tick(wet[c]))
+		}
+		l, r := float64(samples[0][n]), float64(samples[1][n])
+		if pingPong {
+			// The input enters on the left and the echoes cross over
+			d.bufs[0][d.pos] = (l+r)/2 + feedback*echo[1]
+			d.bufs[1][d.pos] = feedback * echo[0]
+		} else {
+			d.bufs[0][d.pos] = l + feedback*echo[0]
+			d.bufs[1][d.pos] = r + feedback*echo[1]
+		}
+		d.pos = (d.pos + 1) % len(d.bufs[0])
+
+		samples[0][n] = float32(l + mix*(wet[0]-l))
+		samples[1][n] = float32(r + mix*(wet[1]-r))
+	}
+}
+
+// read returns the samples at length samples before the write position.
+func (d *delay) read(length float64) [2]float64 {
+	size := len(d.bufs[0])
+	pos := float64(d.pos) - length
+	if pos < 0 {
+		pos += float64(size)
+	}
+	i := int(pos)
+	frac := pos - float64(i)
+	var out [2]float64
+	for c, buf := range d.bufs {
+		out[c] = buf[i] + frac*(buf[(i+1)%size]-buf[i])
+	}
+	return out
+}
+
+// setBeats accepts a number of beats, or a note length like "1/8", with an
+// optional "d" for dotted or "t" for triplet notes.
+func setBeats(v interface{}, dest *atomic.Value) error {
+	var beats float64
+	switch b := v.(type) {
+	case float64:
+		beats = b
+	case int:
+		beats = float64(b)
+	case string:
+		var err error
+		if beats, err = parseNoteLength(b); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("value is not a number or note length: %v", v)
+	}
+	if beats <= 0 || beats > maxDelayBeats {
+		return fmt.Errorf("time must be more than 0 and at most %v beats: %v", maxDelayBeats, beats)
+	}
+	dest.Store(beats)
+	return nil
+}
+
+// parseNoteLength returns the length in beats of a note like "1/8", "1/8d" or
+// "1/4t".
+func parseNoteLength(s string) (float64, error) {
+	scale := 1.
+	switch {
+	case strings.HasSuffix(s, "d"):
+		scale = 1.5
+	case strings.HasSuffix(s, "t"):
+		scale = 2. / 3
+	}
+	parts := strings.Split(strings.TrimRight(s, "dt"), "/")
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("not a valid note length: %v", s)
+	}
+	num, err1 := strconv.Atoi(parts[0])
+	den, err2 := strconv.Atoi(parts[1])
+	if err1 != nil || err2 != nil || den <= 0 {
+		return 0, fmt.Errorf("not a valid note length: %v", s)
+	}
+	return 4 * float64(num) / float64(den) * scale, nil
+}
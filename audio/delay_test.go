@@ -0,0 +1,116 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestParseNoteLength(t *testing.T) {
+	tests := []struct {
+		s     string
+		beats float64
+	}{
+		{"1/4", 1},
+		{"1/8", 0.5},
+		{"1/8d", 0.75},
+		{"1/4t", 2. / 3},
+		{"3/16", 0.75},
+		{"1/1", 4},
+	}
+	for _, test := range tests {
+		beats, err := parseNoteLength(test.s)
+		if err != nil {
+			t.Errorf("%s: %v", test.s, err)
+		} else if math.Abs(beats-test.beats) > 1e-9 {
+			t.Errorf("%s: want %v, got %v", test.s, test.beats, beats)
+		}
+	}
+	for _, s := range []string{"1/0", "1", "a/b", "1/8x"} {
+		if _, err := parseNoteLength(s); err == nil {
+			t.Errorf("%s: expected an error", s)
+		}
+	}
+}
+
+// echoes returns the positions of the peaks of both channels of the impulse
+// response of effect in each period of the given length.
+func echoes(effect Effect, period, periods int) [2][]int {
+	out := impulseResponse(effect, period*periods)
+	var peaks [2][]int
+	for i := range out {
+		for start := 0; start < period*periods; start += period {
+			peak, max := -1, 0.01
+			for n, v := range out[i][start : start+period] {
+				if math.Abs(v) > max {
+					peak, max = start+n, math.Abs(v)
+				}
+			}
+			peaks[i] = append(peaks[i], peak)
+		}
+	}
+	return peaks
+}
+
+func TestDelay(t *testing.T) {
+	tests := []struct {
+		pingPong    bool
+		left, right []int
+	}{
+		{false, []int{0, 22050, 44100}, []int{0, 22050, 44100}},
+		{true, []int{0, 22050, -1}, []int{0, -1, 44100}},
+	}
+	for _, test := range tests {
+		seq := NewSequencer(NewProps())
+		effect, _ := NewEffect("delay", NewProps(), seq)
+		effect.Set(propTime, "1/4")
+		effect.Set(propMix, 0.5)
+		effect.Set(propFeedback, 0.5)
+		effect.Set(propPingPong, test.pingPong)
+		effect.Set(propHighpass, 20.)
+		effect.Set(propLowpass, 20_000.)
+
+		// Periods start halfway between the echoes
+		peaks := echoes(effect, 22050, 3)
+		for i, want := range [2][]int{test.left, test.right} {
+			for n := range want {
+				// The filters in the feedback path shift the peak slightly
+				if got := peaks[i][n]; (got < 0) != (want[n] < 0) || got < want[n] || got > want[n]+10 {
+					t.Errorf("ping-pong %v, channel %d, echo %d: want %v, got %v", test.pingPong, i, n, want[n], got)
+				}
+			}
+		}
+	}
+}
+
+func TestDelayTempo(t *testing.T) {
+	seq := NewSequencer(NewProps())
+	effect, _ := NewEffect("delay", NewProps(), seq)
+	effect.Set(propMix, 1.)
+	effect.Set(propTime, 1.)
+	seq.Set("bpm", 120.)
+
+	// A sine through a delay that changes length must not jump
+	samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+	var last, jump float64
+	change := sampleRate / bufferSize * bufferSize
+	for pos := 0; pos < 2*sampleRate; pos += bufferSize {
+		if pos == change {
+			seq.Set("bpm", 90.)
+		}
+		for n := range samples[0] {
+			v := float32(math.Sin(twoPi * 100 * float64(pos+n) / sampleRate))
+			samples[0][n], samples[1][n] = v, v
+		}
+		effect.Process(samples)
+		for _, v := range samples[0] {
+			if pos > sampleRate/2 {
+				jump = math.Max(jump, math.Abs(float64(v)-last))
+			}
+			last = float64(v)
+		}
+	}
+	// The largest step of the sine itself is about 0.014
+	if jump > 0.02 {
+		t.Errorf("delay jumped by %v after a tempo change", jump)
+	}
+}
@@ -0,0 +1,64 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+const propDrive = "drive"
+
+// distortion is a waveshaper with soft clipping, hard clipping and wave folding.
+type distortion struct {
+	*Props
+	drive *atomic.Value
+	mode  *atomic.Value
+	mix   *atomic.Value
+	gain  *atomic.Value
+}
+
+func newDistortion(props *Props, seq *Sequencer) Effect {
+	return &distortion{
+		Props: props,
+		drive: props.MustRegister(propDrive, setFloat64(0, 48), 12.),
+		mode:  props.MustRegister(propMode, setDistortionMode, "soft"),
+		mix:   props.MustRegister(propMix, setFloat64(0, 1), 1.),
+		gain:  props.MustRegister(PropGain, setFloat64(-24, 24), 0.),
+	}
+}
+
+func (d *distortion) Process(samples [][]float32) {
+	drive := math.Pow(10, d.drive.Load().(float64)/20)
+	gain := math.Pow(10, d.gain.Load().(float64)/20)
+	mix := d.mix.Load().(float64)
+	var shape func(float64) float64
+	switch d.mode.Load().(string) {
+	case "soft":
+		shape = math.Tanh
+	case "hard":
+		shape = func(x float64) float64 { return clamp(x, -1, 1) }
+	case "fold":
+		shape = func(x float64) float64 { return math.Sin(x * math.Pi / 2) }
+	}
+	for i := range samples {
+		for n := range samples[i] {
+			dry := float64(samples[i][n])
+			wet := shape(drive * dry)
+			samples[i][n] = float32(gain * (dry + mix*(wet-dry)))
+		}
+	}
+}
+
+func setDistortionMode(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	switch s {
+	case "soft", "hard", "fold":
+		dest.Store(s)
+		return nil
+	default:
+		return fmt.Errorf("not a valid distortion mode: %v", s)
+	}
+}
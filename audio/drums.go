@@ -0,0 +1,245 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+	"sync/atomic"
+)
+
+type drumModel int
+
+const (
+	drumOff drumModel = iota
+	drumKick
+	drumSnare
+	drumHat
+	drumClap
+)
+
+var drumModels = map[string]drumModel{
+	"off":   drumOff,
+	"kick":  drumKick,
+	"snare": drumSnare,
+	"hat":   drumHat,
+	"clap":  drumClap,
+}
+
+// drumKeyDefaults is the default kit: kick, snare, closed hat, open hat and clap.
+var drumKeyDefaults = []struct {
+	model string
+	decay float64
+	choke int
+}{
+	{"kick", 0.5, 0},
+	{"snare", 0.2, 0},
+	{"hat", 0.05, 0},
+	{"hat", 0.5, 2},
+	{"clap", 0.3, 0},
+}
+
+// Frequencies of the square wave oscillators of the TR-808 cymbal and hi-hat.
+var hatFreqs = [6]float64{205.3, 304.4, 369.6, 522.7, 540, 800}
+
+// drumKeyProps stores the properties of a single key, using the same naming as the
+// sampler: model.N, tune.N, env.decay.N, tone.N, level.N, pan.N and choke.N.
+type drumKeyProps struct {
+	model *atomic.Value
+	tune  *atomic.Value // semitones
+	decay *atomic.Value // seconds
+	tone  *atomic.Value // 0 - 1, the meaning depends on the model
+	level *atomic.Value
+	pan   *atomic.Value
+	choke *atomic.Value
+}
+
+// Drums creates a drum synth where each key plays an analogue style drum model.
+func Drums(props *Props) *Instrument {
+	var keys [numKeys]drumKeyProps
+	for n := range keys {
+		note := strconv.Itoa(n)
+		model, decay, choke := "off", 0.3, 0
+		if n < len(drumKeyDefaults) {
+			d := drumKeyDefaults[n]
+			model, decay, choke = d.model, d.decay, d.choke
+		}
+		keys[n] = drumKeyProps{
+			model: props.MustRegister("model."+note, setDrumModel, model),
+			tune:  props.MustRegister("tune."+note, setFloat64(-24, 24), 0.),
+			decay: props.MustRegister("env.decay."+note, setFloat64(0.01, 5), decay),
+			tone:  props.MustRegister("tone."+note, setFloat64(0, 1), 0.5),
+			level: props.MustRegister("level."+note, setLevel, 0.),
+			pan:   props.MustRegister("pan."+note, setFloat64(-1, 1), 0.),
+			choke: props.MustRegister("choke."+note, setInt, choke),
+		}
+	}
+	voices := make([]Voice, numVoices)
+	for n := range voices {
+		voices[n] = &drumVoice{
+			keys:  &keys,
+			state: stateFree,
+			rand:  rand.New(rand.NewSource(int64(n))),
+		}
+	}
+	return NewInstrument(props, voices)
+}
+
+type drumVoice struct {
+	keys  *[numKeys]drumKeyProps
+	state voiceState
+	pitch int
+	rand  *rand.Rand
+
+	model   drumModel
+	t       int     // samples since the start of the note
+	tune    float64 // frequency ratio
+	tone    float64
+	amp     float64 // amplitude envelope
+	decay   float64 // amplitude envelope multiplier per sample
+	release float64 // multiplier per sample when choked, or 1
+	phases  [6]float64
+	filters [2]biquad
+}
+
+func (v *drumVoice) PlayNote(pitch, velocity, duration int) {
+	props := v.keys[pitch]
+	v.model = props.model.Load().(drumModel)
+	if v.model == drumOff {
+		return
+	}
+	v.pitch = pitch
+	v.state = stateActive
+	v.t = 0
+	v.tune = math.Pow(2, props.tune.Load().(float64)/12)
+	v.tone = props.tone.Load().(float64)
+	v.amp = 1
+	v.decay = decayRate(props.decay.Load().(float64))
+	v.release = 1
+	v.phases = [6]float64{}
+	v.filters[0].reset()
+	v.filters[1].reset()
+
+	switch v.model {
+	case drumSnare:
+		// The tone shifts the noise from dull to bright
+		v.filters[0].calculateCoefficients("highpass", 1000+v.tone*4000, 0.7, 0)
+	case drumHat:
+		v.filters[0].calculateCoefficients("bandpass", (7000+v.tone*5000)*math.Min(v.tune, 1.5), 1.5, 0)
+		v.filters[1].calculateCoefficients("highpass", 6000, 0.7, 0)
+	case drumClap:
+		v.filters[0].calculateCoefficients("bandpass", (800+v.tone*1200)*v.tune, 2, 0)
+	}
+}
+
+// decayRate returns the multiplier per sample for an exponential decay that drops
+// by 60 dB in the given number of seconds.
+func decayRate(seconds float64) float64 {
+	return math.Pow(0.001, 1/(seconds*sampleRate))
+}
+
+func (v *drumVoice) Process(left, right []float64) {
+	props := v.keys[v.pitch]
+	gain := 0.5 * math.Pow(10, props.level.Load().(float64)/20.0)
+	gl, gr := panGains(props.pan.Load().(float64))
+	for n := range left {
+		var sample float64
+		switch v.model {
+		case drumKick:
+			sample = v.kick()
+		case drumSnare:
+			sample = v.snare()
+		case drumHat:
+			sample = v.hat()
+		case drumClap:
+			sample = v.clap()
+		}
+		sample *= gain * v.amp
+		left[n] += gl * sample
+		right[n] += gr * sample
+		v.amp *= v.decay * v.release
+		v.t++
+	}
+	if v.amp < 0.0001 {
+		v.state = stateFree
+		v.pitch = 0
+	}
+}
+
+// kick is a sine wave with a fast downward pitch sweep. The tone sets the depth of
+// the sweep, which is heard as the click of the kick.
+func (v *drumVoice) kick() float64 {
+	t := float64(v.t) / sampleRate
+	sweep := 1 + (1+7*v.tone)*math.Exp(-t/0.03)
+	v.phases[0] += 50 * v.tune * sweep / sampleRate
+	v.phases[0] -= math.Floor(v.phases[0])
+	return math.Sin(twoPi * v.phases[0])
+}
+
+// snare mixes a two-tone body with filtered noise. The tone sets the balance.
+func (v *drumVoice) snare() float64 {
+	t := float64(v.t) / sampleRate
+	v.phases[0] += 180 * v.tune / sampleRate
+	v.phases[1] += 330 * v.tune / sampleRate
+	v.phases[0] -= math.Floor(v.phases[0])
+	v.phases[1] -= math.Floor(v.phases[1])
+	body := (math.Sin(twoPi*v.phases[0]) + 0.5*math.Sin(twoPi*v.phases[1])) * math.Exp(-t/0.05)
+	noise := v.filter(0, 2*v.rand.Float64()-1)
+	return (1-v.tone)*body + (0.3+v.tone)*noise
+}
+
+// hat sums six detuned square waves and filters them, like the TR-808.
+func (v *drumVoice) hat() float64 {
+	var sum float64
+	for n, freq := range hatFreqs {
+		v.phases[n] += freq * v.tune / sampleRate
+		v.phases[n] -= math.Floor(v.phases[n])
+		if v.phases[n] < 0.5 {
+			sum++
+		} else {
+			sum--
+		}
+	}
+	return v.filter(1, v.filter(0, sum/3))
+}
+
+// clap plays three short bursts of noise before the decaying tail.
+func (v *drumVoice) clap() float64 {
+	const burst = sampleRate / 100 // 10ms
+	noise := v.filter(0, 2*v.rand.Float64()-1)
+	if v.t < 3*burst {
+		pos := float64(v.t%burst) / burst
+		return 2 * noise * math.Exp(-pos*5)
+	}
+	return 2 * noise
+}
+
+func (v *drumVoice) filter(n int, sample float64) float64 {
+	buf := [1]float64{sample}
+	v.filters[n].process(buf[:])
+	return buf[0]
+}
+
+func (v *drumVoice) Notify(pitch int) {
+	if v.state != stateActive {
+		return
+	}
+	if p := v.keys[v.pitch].choke.Load().(int); p > 0 && p == pitch {
+		v.release = decayRate(0.01)
+	}
+}
+
+func (v *drumVoice) State() voiceState { return v.state }
+
+func setDrumModel(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	model, ok := drumModels[s]
+	if !ok {
+		return fmt.Errorf("not a valid drum model: %v", s)
+	}
+	dest.Store(model)
+	return nil
+}
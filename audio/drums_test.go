@@ -0,0 +1,32 @@
+package audio
+
+import "testing"
+
+func TestDrumModels(t *testing.T) {
+	inst := Drums(NewProps())
+	for key := range drumKeyDefaults {
+		voice := inst.voices[0]
+		voice.PlayNote(key, 100, sampleRate)
+		if voice.State() != stateActive {
+			t.Fatalf("key %d: voice is not active", key)
+		}
+		left := make([]float64, blockSize)
+		right := make([]float64, blockSize)
+		var peak float64
+		for n := 0; n < 10*sampleRate/blockSize && voice.State() == stateActive; n++ {
+			voice.Process(left, right)
+			for i := range left {
+				if left[i] > peak {
+					peak = left[i]
+				}
+				left[i] = 0
+			}
+		}
+		if peak < 0.01 {
+			t.Errorf("key %d: drum is silent", key)
+		}
+		if voice.State() != stateFree {
+			t.Errorf("key %d: voice didn't decay", key)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"sync/atomic"
+)
+
+// An Effect processes audio in place.
+type Effect interface {
+	Device
+	Process(samples [][]float32)
+}
+
+var effectTypes = map[string]func(*Props, *Sequencer) Effect{
+	"eq":          newEQ,
+	"filter":      newFilterEffect,
+	"distortion":  newDistortion,
+	"bitcrusher":  newBitcrusher,
+	"compressor":  newCompressor,
+	"delay":       newDelay,
+	"reverb":      newReverb,
+	"convolution": newConvolution,
+	"limiter":     newLimiter,
+}
+
+// NewEffect creates an effect of the given type.
+func NewEffect(kind string, props *Props, seq *Sequencer) (Effect, error) {
+	create, ok := effectTypes[kind]
+	if !ok {
+		return nil, fmt.Errorf("unknown effect type %s, must be one of %s",
+			kind, strings.Join(effectKinds(), ", "))
+	}
+	return create(props, seq), nil
+}
+
+// effectKinds returns the names of the available effects.
+func effectKinds() []string {
+	var kinds []string
+	for kind := range effectTypes {
+		kinds = append(kinds, kind)
+	}
+	sort.Strings(kinds)
+	return kinds
+}
+
+// A Chain is an ordered list of effects that can be changed while the audio
+// thread runs it, but only from a single goroutine.
+type Chain struct {
+	effects *atomic.Value // []Effect
+}
+
+func newChain() Chain {
+	effects := &atomic.Value{}
+	effects.Store([]Effect(nil))
+	return Chain{effects: effects}
+}
+
+// Add appends an effect to the end of the chain.
+func (c Chain) Add(effect Effect) {
+	old := c.effects.Load().([]Effect)
+	c.effects.Store(append(old[:len(old):len(old)], effect))
+}
+
+// Insert adds an effect at position pos of the chain.
+func (c Chain) Insert(pos int, effect Effect) error {
+	old := c.effects.Load().([]Effect)
+	if pos < 0 || pos > len(old) {
+		return fmt.Errorf("position must be between 0 and %d: %d", len(old), pos)
+	}
+	effects := make([]Effect, 0, len(old)+1)
+	effects = append(effects, old[:pos]...)
+	effects = append(effects, effect)
+	effects = append(effects, old[pos:]...)
+	c.effects.Store(effects)
+	return nil
+}
+
+// Remove removes an effect from the chain.
+func (c Chain) Remove(effect Effect) error {
+	old := c.effects.Load().([]Effect)
+	var effects []Effect
+	for _, e := range old {
+		if e != effect {
+			effects = append(effects, e)
+		}
+	}
+	if len(effects) == len(old) {
+		return fmt.Errorf("effect is not in the chain")
+	}
+	c.effects.Store(effects)
+	return nil
+}
+
+// Move moves an effect to position pos of the chain.
+func (c Chain) Move(effect Effect, pos int) error {
+	old := c.effects.Load().([]Effect)
+	if pos < 0 || pos >= len(old) {
+		return fmt.Errorf("position must be between 0 and %d: %d", len(old)-1, pos)
+	}
+	var effects []Effect
+	for _, e := range old {
+		if e != effect {
+			effects = append(effects, e)
+		}
+	}
+	if len(effects) == len(old) {
+		return fmt.Errorf("effect is not in the chain")
+	}
+	effects = append(effects[:pos], append([]Effect{effect}, effects[pos:]...)...)
+	c.effects.Store(effects)
+	return nil
+}
+
+// Effects returns the effects in the chain in processing order.
+func (c Chain) Effects() []Effect {
+	return c.effects.Load().([]Effect)
+}
+
+func (c Chain) process(samples [][]float32) {
+	for _, effect := range c.effects.Load().([]Effect) {
+		effect.Process(samples)
+	}
+}
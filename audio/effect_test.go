@@ -0,0 +1,141 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestChain(t *testing.T) {
+	chain := newChain()
+	a, b, c := double{NewProps()}, double{NewProps()}, double{NewProps()}
+	chain.Add(a)
+	if err := chain.Insert(0, b); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Insert(2, c); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Move(c, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := chain.Remove(a); err != nil {
+		t.Fatal(err)
+	}
+	want := []Effect{c, b}
+	got := chain.Effects()
+	if len(got) != len(want) {
+		t.Fatalf("wrong chain: want %v, got %v", want, got)
+	}
+	for n := range want {
+		if got[n] != want[n] {
+			t.Errorf("effect %d: want %v, got %v", n, want[n], got[n])
+		}
+	}
+	if err := chain.Insert(3, a); err == nil {
+		t.Error("expected an error for a position past the end")
+	}
+	if err := chain.Remove(a); err == nil {
+		t.Error("expected an error for an effect that is not in the chain")
+	}
+}
+
+// effectGain returns the gain in dB of effect for a sine at freq Hz and amplitude
+// amp, after half a second.
+func effectGain(effect Effect, freq, amp float64) float64 {
+	sine := func(n int) float64 { return amp * math.Sin(twoPi*freq*float64(n)/sampleRate) }
+	out := response(effect, sampleRate, sine)
+	var in, peak float64
+	for n := sampleRate / 2; n < len(out[0]); n++ {
+		in = math.Max(in, math.Abs(sine(n)))
+		peak = math.Max(peak, math.Abs(out[0][n]))
+	}
+	return 20 * math.Log10(peak/in)
+}
+
+func TestEffects(t *testing.T) {
+	tests := []struct {
+		kind  string
+		props map[string]interface{}
+		freq  float64
+		amp   float64
+		min   float64 // expected gain range in dB
+		max   float64
+	}{
+		{"eq", nil, 1000, 0.5, -0.1, 0.1},
+		{"eq", map[string]interface{}{propLowGain: -12.}, 40, 0.5, -13, -11},
+		{"eq", map[string]interface{}{propMidGain: 6.}, 1000, 0.5, 5.9, 6.1},
+		{"filter", map[string]interface{}{propMode: "highpass"}, 100, 0.5, -50, -30},
+		{"distortion", map[string]interface{}{propMode: "hard", propDrive: 24.}, 100, 0.5, 5.9, 6.1},
+		{"distortion", map[string]interface{}{propDrive: 24., propMix: 0.}, 100, 0.5, -0.1, 0.1},
+		{"compressor", map[string]interface{}{propKnee: 0.}, 100, 0.05, -0.1, 0.1},
+		// 20 dB over the threshold is reduced to 5 dB
+		{"compressor", map[string]interface{}{propKnee: 0., propAttack: 0.0001, propRelease: 5.}, 100, 1, -15.5, -14.5},
+		{"compressor", map[string]interface{}{propKnee: 0., propMakeup: 6.}, 100, 0.05, 5.9, 6.1},
+	}
+	for _, test := range tests {
+		effect, err := NewEffect(test.kind, NewProps(), nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for k, v := range test.props {
+			if err := effect.Set(k, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if db := effectGain(effect, test.freq, test.amp); db < test.min || db > test.max {
+			t.Errorf("%s %v: gain %.2f dB not in range %v - %v", test.kind, test.props, db, test.min, test.max)
+		}
+	}
+	if _, err := NewEffect("flanger", NewProps(), nil); err == nil {
+		t.Error("expected an error for an unknown effect")
+	}
+}
+
+func TestBitcrusher(t *testing.T) {
+	effect, _ := NewEffect("bitcrusher", NewProps(), nil)
+	effect.Set(propBits, 2)
+	effect.Set(propDownsample, 2)
+	in := []float32{0.1, 0.3, 0.3, 0.6, -0.8, 0.2}
+	want := []float32{0, 0, 0.5, 0.5, -1, -1}
+	samples := [][]float32{append([]float32(nil), in...), append([]float32(nil), in...)}
+	effect.Process(samples)
+	for n := range want {
+		if samples[0][n] != want[n] {
+			t.Errorf("sample %d: want %v, got %v", n, want[n], samples[0][n])
+		}
+	}
+}
+
+func TestSidechain(t *testing.T) {
+	sink := newTestSink()
+	pad, kick := constant(0.5), constant(1)
+	sink.AddSources(pad, kick)
+	sink.Channel(kick).Set(PropMute, true)
+	comp, _ := NewEffect("compressor", NewProps(), nil)
+	comp.Set(propKnee, 0.)
+	sink.Channel(pad).Add(comp)
+
+	tests := []struct {
+		key       Source
+		reduction float64 // in dB
+	}{
+		{kick, 15},  // 20 dB over the threshold
+		{nil, 10.5}, // 14 dB over the threshold
+	}
+	samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+	for _, test := range tests {
+		if err := sink.Sidechain(comp, test.key); err != nil {
+			t.Fatal(err)
+		}
+		for n := 0; n < sampleRate/bufferSize; n++ {
+			sink.Process(samples)
+		}
+		want := 0.5 * math.Pow(10, -test.reduction/20)
+		if got := float64(samples[0][0]); math.Abs(got-want) > 1e-3 {
+			t.Errorf("key %v: want %v, got %v", test.key, want, got)
+		}
+	}
+	if err := sink.Sidechain(double{NewProps()}, kick); err == nil {
+		t.Error("expected an error for an effect without a sidechain")
+	}
+}
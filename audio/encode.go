@@ -0,0 +1,64 @@
+package audio
+
+import (
+	"bufio"
+	"encoding/binary"
+	"math"
+	"os"
+)
+
+// SaveSound writes snd to a stereo, 32 bit float wav file, which becomes the file
+// of snd.
+func SaveSound(file string, snd *Sound) error {
+	f, err := os.Create(file)
+	if err != nil {
+		return err
+	}
+	w := bufio.NewWriter(f)
+	size := uint32(snd.len() * 2 * 4)
+	header := struct {
+		RIFF       [4]byte
+		FileSize   uint32
+		WAVE       [4]byte
+		FMT        [4]byte
+		FmtSize    uint32
+		Format     uint16
+		Channels   uint16
+		SampleRate uint32
+		ByteRate   uint32
+		BlockAlign uint16
+		Bits       uint16
+		DATA       [4]byte
+		DataSize   uint32
+	}{
+		RIFF:       [4]byte{'R', 'I', 'F', 'F'},
+		FileSize:   36 + size,
+		WAVE:       [4]byte{'W', 'A', 'V', 'E'},
+		FMT:        [4]byte{'f', 'm', 't', ' '},
+		FmtSize:    16,
+		Format:     wavFormatFloat,
+		Channels:   2,
+		SampleRate: uint32(snd.sampleRate),
+		ByteRate:   uint32(snd.sampleRate) * 8,
+		BlockAlign: 8,
+		Bits:       32,
+		DATA:       [4]byte{'d', 'a', 't', 'a'},
+		DataSize:   size,
+	}
+	binary.Write(w, binary.LittleEndian, &header)
+	var buf [8]byte
+	for n := 0; n < snd.len(); n++ {
+		binary.LittleEndian.PutUint32(buf[:], math.Float32bits(float32(snd.bufs[0][n])))
+		binary.LittleEndian.PutUint32(buf[4:], math.Float32bits(float32(snd.bufs[1][n])))
+		w.Write(buf[:])
+	}
+	if err := w.Flush(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	snd.file = file
+	return nil
+}
@@ -70,11 +70,7 @@ func (e *envelope) startAttack() {
 	e.val = 0
 	e.state = stateAttack
 	e.attackRate = 1.0 / (e.attack * sampleRate)
-	if e.sustain > 0 {
-		e.decayRate = 1.0 - e.sustain/(e.decay*sampleRate)
-	} else {
-		e.decayRate = 1.0 / (e.decay * sampleRate)
-	}
+	e.decayRate = (1.0 - e.sustain) / (e.decay * sampleRate)
 }
 
 func (e *envelope) startRelease() {
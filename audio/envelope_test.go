@@ -0,0 +1,32 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEnvelopeDecay(t *testing.T) {
+	tests := []struct {
+		sustain float64
+		at      float64 // seconds after the attack
+		want    float64
+	}{
+		{0.5, 0, 1},
+		{0.5, 0.05, 0.75},
+		{0.5, 0.1, 0.5},
+		{0.5, 0.2, 0.5},
+		{0, 0.025, 0.75},
+		{0, 0.075, 0.25},
+	}
+	for _, test := range tests {
+		e := &envelope{attack: 0.01, decay: 0.1, sustain: test.sustain, release: 0.1}
+		e.startAttack()
+		var v float64
+		for n := 0; n < int((0.01+test.at)*sampleRate); n++ {
+			v = e.value()
+		}
+		if math.Abs(v-test.want) > 0.01 {
+			t.Errorf("sustain %v, %v s into the decay: want %v, got %v", test.sustain, test.at, test.want, v)
+		}
+	}
+}
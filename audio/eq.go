@@ -0,0 +1,59 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	propLowFreq  = "low.freq"
+	propLowGain  = "low.gain"
+	propMidFreq  = "mid.freq"
+	propMidGain  = "mid.gain"
+	propMidQ     = "mid.q"
+	propHighFreq = "high.freq"
+	propHighGain = "high.gain"
+)
+
+// eq is a three band equalizer with a low shelf, a peak and a high shelf.
+type eq struct {
+	*Props
+	lowFreq  *atomic.Value
+	lowGain  *atomic.Value
+	midFreq  *atomic.Value
+	midGain  *atomic.Value
+	midQ     *atomic.Value
+	highFreq *atomic.Value
+	highGain *atomic.Value
+	bands    [2][3]biquad // left and right
+}
+
+func newEQ(props *Props, seq *Sequencer) Effect {
+	setBandGain := setFloat64(-24, 24)
+	return &eq{
+		Props:    props,
+		lowFreq:  props.MustRegister(propLowFreq, setFloat64(20, 1000), 100.),
+		lowGain:  props.MustRegister(propLowGain, setBandGain, 0.),
+		midFreq:  props.MustRegister(propMidFreq, setFloat64(100, 10_000), 1000.),
+		midGain:  props.MustRegister(propMidGain, setBandGain, 0.),
+		midQ:     props.MustRegister(propMidQ, setFloat64(0.1, 10), math.Sqrt2/2),
+		highFreq: props.MustRegister(propHighFreq, setFloat64(1000, 20_000), 8000.),
+		highGain: props.MustRegister(propHighGain, setBandGain, 0.),
+	}
+}
+
+func (e *eq) Process(samples [][]float32) {
+	for i := range e.bands {
+		bands := &e.bands[i]
+		bands[0].calculateCoefficients("lowshelf", e.lowFreq.Load().(float64), math.Sqrt2/2, e.lowGain.Load().(float64))
+		bands[1].calculateCoefficients("peak", e.midFreq.Load().(float64), e.midQ.Load().(float64), e.midGain.Load().(float64))
+		bands[2].calculateCoefficients("highshelf", e.highFreq.Load().(float64), math.Sqrt2/2, e.highGain.Load().(float64))
+		for n := range samples[i] {
+			v := float64(samples[i][n])
+			for b := range bands {
+				v = bands[b].tick(v)
+			}
+			samples[i][n] = float32(v)
+		}
+	}
+}
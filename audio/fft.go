@@ -0,0 +1,56 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+)
+
+// fft computes the discrete Fourier transform of x in place. The length of x has
+// to be a power of 2.
+func fft(x []complex128) {
+	transform(x, false)
+}
+
+// ifft computes the inverse of fft in place, including the 1/N scaling.
+func ifft(x []complex128) {
+	transform(x, true)
+	scale := complex(1/float64(len(x)), 0)
+	for n := range x {
+		x[n] *= scale
+	}
+}
+
+func transform(x []complex128, inverse bool) {
+	n := len(x)
+	if n&(n-1) != 0 {
+		panic("fft size must be a power of 2")
+	}
+	// bit reversal permutation
+	for i, j := 1, 0; i < n; i++ {
+		bit := n >> 1
+		for ; j&bit != 0; bit >>= 1 {
+			j ^= bit
+		}
+		j ^= bit
+		if i < j {
+			x[i], x[j] = x[j], x[i]
+		}
+	}
+	sign := -1.
+	if inverse {
+		sign = 1
+	}
+	for size := 2; size <= n; size <<= 1 {
+		w := cmplx.Rect(1, sign*2*math.Pi/float64(size))
+		for start := 0; start < n; start += size {
+			wn := complex(1, 0)
+			for k := 0; k < size/2; k++ {
+				a := x[start+k]
+				b := x[start+k+size/2] * wn
+				x[start+k] = a + b
+				x[start+k+size/2] = a - b
+				wn *= w
+			}
+		}
+	}
+}
@@ -0,0 +1,192 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+// filter is a resonant multi-mode filter with a slope of 12 or 24 dB/oct. The 24
+// dB/oct slope is made by running a second stage without resonance.
+type filter struct {
+	stages [2]biquad
+	slope  int
+}
+
+func (f *filter) process(buf []float64) {
+	f.stages[0].process(buf)
+	if f.slope == 24 {
+		f.stages[1].process(buf)
+	}
+}
+
+func (f *filter) tick(in float64) float64 {
+	out := f.stages[0].tick(in)
+	if f.slope == 24 {
+		out = f.stages[1].tick(out)
+	}
+	return out
+}
+
+func (f *filter) calculateCoefficients(mode string, freq, q, gain float64) {
+	f.stages[0].calculateCoefficients(mode, freq, q, gain)
+	if f.slope == 24 {
+		f.stages[1].calculateCoefficients(mode, freq, math.Sqrt2/2, gain)
+	}
+}
+
+func (f *filter) reset() {
+	f.stages[0].reset()
+	f.stages[1].reset()
+}
+
+// biquad is a second order filter based on https://www.w3.org/2011/audio/audio-eq-cookbook.html
+type biquad struct {
+	c0, c1, c2, c3, c4 float64
+
+	// state
+	y1, y2 float64 // y[n-1] y[n-2]
+}
+
+func (f *biquad) process(buf []float64) {
+	for n := range buf {
+		buf[n] = f.tick(buf[n])
+	}
+}
+
+func (f *biquad) tick(in float64) float64 {
+	out := f.c0*in + f.y1
+	f.y1 = f.c1*in - f.c3*out + f.y2
+	f.y2 = f.c2*in - f.c4*out
+	return out
+}
+
+func (f *biquad) reset() {
+	f.y1 = 0
+	f.y2 = 0
+}
+
+// calculateCoefficients updates the filter for the given mode, frequency and q. The
+// gain in dB is only used by the peak and shelf modes.
+func (f *biquad) calculateCoefficients(mode string, freq, q, gain float64) {
+	omega := 2 * math.Pi * freq / sampleRate
+	cos := math.Cos(omega)
+	sin := math.Sin(omega)
+	alpha := sin / (2. * q)
+
+	b0, b1, b2 := 0., 0., 0.
+	a0, a1, a2 := 1+alpha, -2*cos, 1-alpha
+
+	switch mode {
+	case "lowpass":
+		b0 = (1 - cos) / 2
+		b1 = 1 - cos
+		b2 = b0
+	case "highpass":
+		b0 = (1 + cos) / 2
+		b1 = -(1 + cos)
+		b2 = b0
+	case "bandpass":
+		b0 = alpha
+		b1 = 0
+		b2 = -alpha
+	case "notch":
+		b0 = 1
+		b1 = -2 * cos
+		b2 = 1
+	case "peak":
+		A := math.Pow(10, gain/40)
+		b0 = 1 + alpha*A
+		b1 = -2 * cos
+		b2 = 1 - alpha*A
+		a0 = 1 + alpha/A
+		a2 = 1 - alpha/A
+	case "lowshelf", "highshelf":
+		A := math.Pow(10, gain/40)
+		sign := 1.
+		if mode == "highshelf" {
+			sign = -1
+		}
+		beta := 2 * math.Sqrt(A) * alpha
+		b0 = A * ((A + 1) - sign*(A-1)*cos + beta)
+		b1 = sign * 2 * A * ((A - 1) - sign*(A+1)*cos)
+		b2 = A * ((A + 1) - sign*(A-1)*cos - beta)
+		a0 = (A + 1) + sign*(A-1)*cos + beta
+		a1 = -sign * 2 * ((A - 1) + sign*(A+1)*cos)
+		a2 = (A + 1) + sign*(A-1)*cos - beta
+	}
+
+	f.c0 = b0 / a0
+	f.c1 = b1 / a0
+	f.c2 = b2 / a0
+	f.c3 = a1 / a0
+	f.c4 = a2 / a0
+}
+
+func setFilterMode(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	switch s {
+	case "lowpass", "highpass", "bandpass", "notch", "peak", "lowshelf", "highshelf":
+		dest.Store(s)
+		return nil
+	default:
+		return fmt.Errorf("not a valid filter mode: %v", s)
+	}
+}
+
+func setFilterSlope(v interface{}, dest *atomic.Value) error {
+	var slope atomic.Value
+	if err := setInt(v, &slope); err != nil {
+		return err
+	}
+	if s := slope.Load().(int); s != 12 && s != 24 {
+		return fmt.Errorf("filter slope must be 12 or 24: %v", s)
+	}
+	dest.Store(slope.Load())
+	return nil
+}
+
+const (
+	propMode  = "mode"
+	propSlope = "slope"
+)
+
+// filterEffect is the filter of the synth as a stereo effect.
+type filterEffect struct {
+	*Props
+	cutoff    *atomic.Value
+	resonance *atomic.Value
+	mode      *atomic.Value
+	slope     *atomic.Value
+	gain      *atomic.Value
+	filters   [2]filter // left and right
+}
+
+func newFilterEffect(props *Props, seq *Sequencer) Effect {
+	return &filterEffect{
+		Props:     props,
+		cutoff:    props.MustRegister(propCutoff, setFloat64(20, 20_000), 1000.0),
+		resonance: props.MustRegister(propResonance, setFloat64(0.1, 20), math.Sqrt2/2),
+		mode:      props.MustRegister(propMode, setFilterMode, "lowpass"),
+		slope:     props.MustRegister(propSlope, setFilterSlope, 12),
+		gain:      props.MustRegister(PropGain, setFloat64(-24, 24), 0.),
+	}
+}
+
+func (f *filterEffect) Process(samples [][]float32) {
+	for i := range f.filters {
+		f.filters[i].slope = f.slope.Load().(int)
+		f.filters[i].calculateCoefficients(
+			f.mode.Load().(string),
+			f.cutoff.Load().(float64),
+			f.resonance.Load().(float64),
+			f.gain.Load().(float64),
+		)
+		for n := range samples[i] {
+			samples[i][n] = float32(f.filters[i].tick(float64(samples[i][n])))
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFilterModes(t *testing.T) {
+	type test struct {
+		mode  string
+		slope int
+		freq  float64 // frequency of the test signal
+		min   float64 // expected gain range in dB
+		max   float64
+	}
+	tests := []test{
+		{mode: "lowpass", slope: 12, freq: 100, min: -1, max: 1},
+		{mode: "lowpass", slope: 12, freq: 10_000, min: -50, max: -35},
+		{mode: "lowpass", slope: 24, freq: 10_000, min: -100, max: -70},
+		{mode: "highpass", slope: 12, freq: 100, min: -50, max: -30},
+		{mode: "highpass", slope: 12, freq: 10_000, min: -1, max: 1},
+		{mode: "bandpass", slope: 12, freq: 1000, min: -1, max: 1},
+		{mode: "bandpass", slope: 12, freq: 100, min: -30, max: -15},
+		{mode: "notch", slope: 12, freq: 1000, min: math.Inf(-1), max: -30},
+		{mode: "peak", slope: 12, freq: 1000, min: 5, max: 7},
+		{mode: "lowshelf", slope: 12, freq: 50, min: 5, max: 7},
+		{mode: "lowshelf", slope: 12, freq: 10_000, min: -1, max: 1},
+		{mode: "highshelf", slope: 12, freq: 100, min: -1, max: 1},
+		{mode: "highshelf", slope: 12, freq: 10_000, min: 5, max: 7},
+	}
+	for _, test := range tests {
+		f := &filter{slope: test.slope}
+		f.calculateCoefficients(test.mode, 1000, math.Sqrt2/2, 6)
+
+		buf := make([]float64, sampleRate)
+		for n := range buf {
+			buf[n] = math.Sin(twoPi * test.freq * float64(n) / sampleRate)
+		}
+		f.process(buf)
+
+		// skip the first part to ignore the filter's transient response
+		var peak float64
+		for _, s := range buf[sampleRate/2:] {
+			peak = math.Max(peak, math.Abs(s))
+		}
+		if db := 20 * math.Log10(peak); db < test.min || db > test.max {
+			t.Errorf("%s %d dB/oct at %v Hz: gain %.1f dB not in range %v - %v",
+				test.mode, test.slope, test.freq, db, test.min, test.max)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package audio
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	"github.com/mewkiz/flac"
+)
+
+// decodeFLAC decodes a flac file.
+func decodeFLAC(data []byte, snd *Sound) error {
+	stream, err := flac.New(bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	info := stream.Info
+	if info.SampleRate == 0 {
+		return errors.New("invalid sample rate: 0")
+	}
+	channels := make([][]float64, info.NChannels)
+	scale := 1 / float64(uint64(1)<<uint(info.BitsPerSample-1))
+	for {
+		frame, err := stream.ParseNext()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		for c := range channels {
+			for _, v := range frame.Subframes[c].Samples {
+				channels[c] = append(channels[c], float64(v)*scale)
+			}
+		}
+	}
+	if len(channels) == 0 {
+		return errNoAudio
+	}
+	snd.setChannels(channels, float64(info.SampleRate))
+	return nil
+}
@@ -0,0 +1,193 @@
+package audio
+
+import (
+	"math"
+	"strconv"
+	"sync/atomic"
+)
+
+const (
+	numOperators = 4
+
+	propAlgorithm  = "algorithm"
+	propOpRatio    = "ratio"
+	propOpLevel    = "level"
+	propOpFeedback = "feedback"
+
+	// maxModIndex is the phase offset in cycles caused by a modulator at full level.
+	maxModIndex = 2.
+	// maxFeedback is the phase offset in cycles caused by an operator modulating
+	// itself at full feedback.
+	maxFeedback = 0.5
+)
+
+// algorithm describes how the operators of an FM synth are connected. Operators are
+// processed from the highest to the lowest number, so an operator can only
+// modulate operators with a lower number.
+type algorithm struct {
+	modulators [numOperators][]int // modulators[n] lists the operators modulating operator n
+	carriers   []int               // operators that are mixed into the output
+}
+
+// The algorithms of 4-operator FM synths like the Yamaha TX81Z, with operators
+// numbered from 0.
+var algorithms = []algorithm{
+	// 4 → 3 → 2 → 1
+	{modulators: [numOperators][]int{{1}, {2}, {3}, nil}, carriers: []int{0}},
+	// (3 + 4) → 2 → 1
+	{modulators: [numOperators][]int{{1}, {2, 3}, nil, nil}, carriers: []int{0}},
+	// (4 + (3 → 2)) → 1
+	{modulators: [numOperators][]int{{1, 3}, {2}, nil, nil}, carriers: []int{0}},
+	// ((4 → 3) + 2) → 1
+	{modulators: [numOperators][]int{{1, 2}, nil, {3}, nil}, carriers: []int{0}},
+	// (2 → 1) + (4 → 3)
+	{modulators: [numOperators][]int{{1}, nil, {3}, nil}, carriers: []int{0, 2}},
+	// 4 → (1 + 2 + 3)
+	{modulators: [numOperators][]int{{3}, {3}, {3}, nil}, carriers: []int{0, 1, 2}},
+	// 1 + 2 + (4 → 3)
+	{modulators: [numOperators][]int{nil, nil, {3}, nil}, carriers: []int{0, 1, 2}},
+	// 1 + 2 + 3 + 4
+	{modulators: [numOperators][]int{}, carriers: []int{0, 1, 2, 3}},
+}
+
+// operatorProps are registered per operator with a prefix, e.g. op2.ratio.
+type operatorProps struct {
+	ratio      *atomic.Value
+	level      *atomic.Value
+	feedback   *atomic.Value
+	envAttack  *atomic.Value
+	envDecay   *atomic.Value
+	envSustain *atomic.Value
+	envRelease *atomic.Value
+}
+
+// FM creates a 4-operator phase modulation synth.
+func FM(props *Props) *Instrument {
+	algo := props.MustRegister(propAlgorithm, setIntRange(1, len(algorithms)), 1)
+	var ops [numOperators]operatorProps
+	for n := range ops {
+		prefix := "op" + strconv.Itoa(n+1) + "."
+		ops[n] = operatorProps{
+			ratio:      props.MustRegister(prefix+propOpRatio, setFloat64(0.125, 32), 1.),
+			level:      props.MustRegister(prefix+propOpLevel, setFloat64(0, 1), 0.5),
+			feedback:   props.MustRegister(prefix+propOpFeedback, setFloat64(0, 1), 0.),
+			envAttack:  props.MustRegister(prefix+propEnvAttack, setEnvParam, 0.001),
+			envDecay:   props.MustRegister(prefix+propEnvDecay, setEnvParam, 1.),
+			envSustain: props.MustRegister(prefix+propEnvSustain, setFloat64(0, 1), 0.5),
+			envRelease: props.MustRegister(prefix+propEnvRelease, setEnvParam, 0.2),
+		}
+	}
+	voices := make([]Voice, numVoices)
+	for n := range voices {
+		v := &fmVoice{
+			algorithm: algo,
+			props:     ops,
+			state:     stateFree,
+		}
+		for op := range v.ops {
+			v.ops[op].env = &envelope{}
+		}
+		voices[n] = v
+	}
+	return NewInstrument(props, voices)
+}
+
+type operator struct {
+	env        *envelope
+	phase      float64
+	phaseDelta float64
+	level      float64
+	feedback   float64
+	out        [2]float64 // the last two output samples, for feedback
+}
+
+type fmVoice struct {
+	algorithm     *atomic.Value
+	props         [numOperators]operatorProps
+	ops           [numOperators]operator
+	algo          *algorithm
+	state         voiceState
+	pitch         int
+	duration      int
+	samplesPlayed int
+}
+
+func (v *fmVoice) PlayNote(pitch, velocity, duration int) {
+	v.pitch = pitch
+	v.duration = duration
+	v.samplesPlayed = 0
+	v.algo = &algorithms[v.algorithm.Load().(int)-1]
+	freq := midiToFreq(pitch)
+	for n := range v.ops {
+		op, props := &v.ops[n], &v.props[n]
+		op.phase = 0
+		op.out = [2]float64{}
+		op.phaseDelta = freq * props.ratio.Load().(float64) / sampleRate
+		op.env.attack = props.envAttack.Load().(float64)
+		op.env.decay = props.envDecay.Load().(float64)
+		op.env.sustain = props.envSustain.Load().(float64)
+		op.env.release = props.envRelease.Load().(float64)
+		op.env.startAttack()
+	}
+	v.state = stateActive
+}
+
+func (v *fmVoice) Process(left, right []float64) {
+	for n := range v.ops {
+		v.ops[n].level = v.props[n].level.Load().(float64)
+		v.ops[n].feedback = v.props[n].feedback.Load().(float64)
+	}
+	gain := 0.1 / float64(len(v.algo.carriers))
+	for i := range left {
+		for n := numOperators - 1; n >= 0; n-- {
+			op := &v.ops[n]
+			mod := op.feedback * maxFeedback * (op.out[0] + op.out[1]) / 2
+			for _, m := range v.algo.modulators[n] {
+				mod += maxModIndex * v.ops[m].out[0]
+			}
+			out := op.level * op.env.value() * math.Sin(twoPi*(op.phase+mod))
+			op.out[1] = op.out[0]
+			op.out[0] = out
+			op.phase += op.phaseDelta
+			op.phase -= math.Floor(op.phase)
+		}
+		var sample float64
+		for _, c := range v.algo.carriers {
+			sample += v.ops[c].out[0]
+		}
+		left[i] += gain * sample
+		right[i] += gain * sample
+	}
+	v.samplesPlayed += len(left)
+	if v.samplesPlayed >= v.duration && v.state != stateReleased {
+		v.state = stateReleased
+		for n := range v.ops {
+			v.ops[n].env.startRelease()
+		}
+	}
+	if v.state == stateReleased && v.silent() {
+		v.state = stateFree
+		v.pitch = 0
+	}
+}
+
+// silent reports whether the envelopes of all carriers have ended.
+func (v *fmVoice) silent() bool {
+	for _, c := range v.algo.carriers {
+		if v.ops[c].env.state != stateInit {
+			return false
+		}
+	}
+	return true
+}
+
+func (v *fmVoice) Notify(pitch int) {
+	if v.pitch == pitch && v.state == stateActive {
+		for n := range v.ops {
+			v.ops[n].env.release = 0.001
+			v.ops[n].env.startRelease()
+		}
+	}
+}
+
+func (v *fmVoice) State() voiceState { return v.state }
@@ -0,0 +1,37 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestFMVoice(t *testing.T) {
+	inst := FM(NewProps())
+	for key, val := range map[string]interface{}{
+		"algorithm":       1,
+		"op1.level":       1.,
+		"op1.env.attack":  0.0005,
+		"op1.env.sustain": 1.,
+		"op2.level":       0.,
+		"op3.level":       0.,
+		"op4.level":       0.,
+	} {
+		if err := inst.Set(key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	voice := inst.voices[0]
+	voice.PlayNote(69, 100, sampleRate)
+
+	left := make([]float64, 1024)
+	right := make([]float64, 1024)
+	voice.Process(left, right)
+
+	// Without modulation the carrier is a plain sine wave at 440 Hz.
+	for n := 100; n < len(left); n++ {
+		want := 0.1 * math.Sin(twoPi*440*float64(n)/sampleRate)
+		if math.Abs(left[n]-want) > 1e-6 || left[n] != right[n] {
+			t.Fatalf("sample %d: want %v, got %v %v", n, want, left[n], right[n])
+		}
+	}
+}
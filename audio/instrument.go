@@ -31,7 +31,7 @@ type event struct {
 
 type Voice interface {
 	PlayNote(pitch, velocity, duration int)
-	Process(buf []float64)
+	Process(left, right []float64)
 	State() voiceState
 	Notify(pitch int)
 }
@@ -40,18 +40,23 @@ type Instrument struct {
 	*Props
 	voices []Voice
 	events *eventBuffer
-	buf    []float64
+	bufs   [2][]float64
 	level  *atomic.Value
+	pan    *atomic.Value
 }
 
-const propLevel = "level"
+const (
+	propLevel = "level"
+	PropPan   = "pan"
+)
 
 func NewInstrument(props *Props, voices []Voice) *Instrument {
 	instrument := &Instrument{
 		events: newEventBuffer(64),
-		buf:    make([]float64, bufferSize),
+		bufs:   [2][]float64{make([]float64, bufferSize), make([]float64, bufferSize)},
 		Props:  props,
 		level:  props.MustRegister(propLevel, setLevel, 0.1),
+		pan:    props.MustRegister(PropPan, setFloat64(-1, 1), 0.),
 	}
 	for _, v := range voices {
 		instrument.voices = append(instrument.voices, v)
@@ -63,6 +68,7 @@ func (i *Instrument) PlayNote(offset, pitch, velocity, duration int) {
 	i.events.push(event{
 		pitch:    pitch,
 		offset:   offset,
+		velocity: velocity,
 		duration: duration,
 	})
 }
@@ -85,16 +91,19 @@ func (i *Instrument) Process(samples [][]float32) {
 			if voice.State() == stateFree {
 				continue
 			}
-			voice.Process(i.buf[n : n+blockSize])
+			voice.Process(i.bufs[0][n:n+blockSize], i.bufs[1][n:n+blockSize])
 		}
 	}
 	db := i.level.Load().(float64)
 	gain := math.Pow(10, db/20.0)
-	for n := range i.buf {
-		sample := float32(gain * i.buf[n])
-		samples[0][n] += sample
-		samples[1][n] += sample
-		i.buf[n] = 0
+	gl, gr := panGains(i.pan.Load().(float64))
+	gl, gr = gl*gain, gr*gain
+	left, right := i.bufs[0], i.bufs[1]
+	for n := range left {
+		samples[0][n] += float32(gl * left[n])
+		samples[1][n] += float32(gr * right[n])
+		left[n] = 0
+		right[n] = 0
 	}
 }
 
@@ -106,3 +115,13 @@ func (i *Instrument) findFreeVoice() Voice {
 	}
 	return nil
 }
+
+// panGains returns the left and right gain for pan, which ranges from -1 (left) to
+// 1 (right). It follows the constant power curve, scaled so the louder side is
+// at unity gain. Panning never boosts a signal, so pan stages can be stacked.
+func panGains(pan float64) (float64, float64) {
+	angle := (pan + 1) * math.Pi / 4
+	l, r := math.Cos(angle), math.Sin(angle)
+	norm := math.Max(l, r)
+	return l / norm, r / norm
+}
@@ -0,0 +1,107 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+type interpolation int
+
+const (
+	interpLinear interpolation = iota
+	interpCubic
+	interpSinc
+)
+
+var interpolations = map[string]interpolation{
+	"linear": interpLinear,
+	"cubic":  interpCubic,
+	"sinc":   interpSinc,
+}
+
+const (
+	sincTaps       = 8   // zero crossings on either side of the kernel
+	sincResolution = 512 // table entries per zero crossing
+	// maxSincRate limits how wide the kernel gets at high playback rates, so the
+	// work per sample stays bounded. Faster playback aliases a little.
+	maxSincRate = 4
+)
+
+// sincTable holds one side of a Blackman windowed sinc kernel.
+var sincTable = func() []float64 {
+	table := make([]float64, sincTaps*sincResolution+2)
+	for n := range table {
+		x := float64(n) / sincResolution
+		if x > sincTaps {
+			break
+		}
+		w := 0.42 + 0.5*math.Cos(math.Pi*x/sincTaps) + 0.08*math.Cos(2*math.Pi*x/sincTaps)
+		if x == 0 {
+			table[n] = 1
+		} else {
+			table[n] = w * math.Sin(math.Pi*x) / (math.Pi * x)
+		}
+	}
+	return table
+}()
+
+// interpolate returns the value of buf at the fractional position pos. Positions
+// outside of buf are treated as silence. rate is the playback speed, which is used
+// by sinc interpolation to filter out frequencies that would alias.
+func interpolate(buf []float64, pos, rate float64, mode interpolation) float64 {
+	i := int(math.Floor(pos))
+	frac := pos - float64(i)
+	switch mode {
+	case interpCubic:
+		// Catmull-Rom spline
+		y0, y1, y2, y3 := at(buf, i-1), at(buf, i), at(buf, i+1), at(buf, i+2)
+		a := -0.5*y0 + 1.5*y1 - 1.5*y2 + 0.5*y3
+		b := y0 - 2.5*y1 + 2*y2 - 0.5*y3
+		c := -0.5*y0 + 0.5*y2
+		return ((a*frac+b)*frac+c)*frac + y1
+	case interpSinc:
+		return sincInterpolate(buf, i, frac, rate)
+	default:
+		y0, y1 := at(buf, i), at(buf, i+1)
+		return y0 + frac*(y1-y0)
+	}
+}
+
+func sincInterpolate(buf []float64, i int, frac, rate float64) float64 {
+	// When playing faster than the original speed, the cutoff of the kernel is
+	// lowered, which makes it wider.
+	cutoff := math.Min(1, 1/math.Min(math.Abs(rate), maxSincRate))
+	width := int(math.Ceil(sincTaps / cutoff))
+	var sum float64
+	for k := -width + 1; k <= width; k++ {
+		x := math.Abs(float64(k)-frac) * cutoff * sincResolution
+		n := int(x)
+		if n >= sincTaps*sincResolution {
+			continue
+		}
+		w := sincTable[n] + (x-float64(n))*(sincTable[n+1]-sincTable[n])
+		sum += at(buf, i+k) * w
+	}
+	return sum * cutoff
+}
+
+func at(buf []float64, i int) float64 {
+	if i < 0 || i >= len(buf) {
+		return 0
+	}
+	return buf[i]
+}
+
+func setInterpolation(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	mode, ok := interpolations[s]
+	if !ok {
+		return fmt.Errorf("not a valid interpolation: %v", s)
+	}
+	dest.Store(mode)
+	return nil
+}
@@ -0,0 +1,92 @@
+package audio
+
+import (
+	"math"
+	"strconv"
+	"testing"
+)
+
+func TestInterpolate(t *testing.T) {
+	const freq = 1000.
+	buf := make([]float64, 1024)
+	for n := range buf {
+		buf[n] = math.Sin(twoPi * freq * float64(n) / sampleRate)
+	}
+	type test struct {
+		mode      interpolation
+		tolerance float64
+	}
+	tests := []test{
+		{interpLinear, 1e-2},
+		{interpCubic, 1e-3},
+		{interpSinc, 1e-3},
+	}
+	for _, test := range tests {
+		for pos := 100.; pos < 900; pos += 0.37 {
+			want := math.Sin(twoPi * freq * pos / sampleRate)
+			got := interpolate(buf, pos, 1, test.mode)
+			if math.Abs(want-got) > test.tolerance {
+				t.Errorf("mode %v at %v: want %v, got %v", test.mode, pos, want, got)
+				break
+			}
+		}
+		if want, got := buf[200], interpolate(buf, 200, 1, test.mode); math.Abs(want-got) > 1e-9 {
+			t.Errorf("mode %v: not exact at integer position: want %v, got %v", test.mode, want, got)
+		}
+	}
+}
+
+func TestSincAntiAliasing(t *testing.T) {
+	// A tone at 3/4 of Nyquist played back an octave higher would alias, so it
+	// should be filtered out.
+	buf := make([]float64, 4096)
+	for n := range buf {
+		buf[n] = math.Sin(twoPi * 0.375 * float64(n))
+	}
+	var peak float64
+	for pos := 1000.; pos < 3000; pos += 2 {
+		peak = math.Max(peak, math.Abs(interpolate(buf, pos+0.5, 2, interpSinc)))
+	}
+	if peak > 0.05 {
+		t.Errorf("aliasing tone not filtered: peak %v", peak)
+	}
+}
+
+func TestSincHighRate(t *testing.T) {
+	buf := make([]float64, 4096)
+	for n := range buf {
+		buf[n] = math.Sin(twoPi * 0.01 * float64(n))
+	}
+	// Above maxSincRate the kernel doesn't get any wider
+	if want, got := interpolate(buf, 2000.5, maxSincRate, interpSinc), interpolate(buf, 2000.5, 1e4, interpSinc); want != got {
+		t.Errorf("kernel not capped: want %v, got %v", want, got)
+	}
+
+	// The highest rate: a zone rooted at the lowest key played at the highest key,
+	// tuned up 4 octaves
+	const high = numKeys - 1
+	mapping := &SoundMapping{}
+	mapping.PutZone(0, 0, high, &Sound{bufs: [2][]float64{buf, buf}, loop: loopOff, sampleRate: 2 * sampleRate})
+	sampler := Sampler(NewProps(), NewSequencer(NewProps()))
+	for key, val := range map[string]interface{}{
+		PropSoundMap:                 mapping,
+		"interp":                     "sinc",
+		"tune." + strconv.Itoa(high): 48.,
+	} {
+		if err := sampler.Set(key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	voice := sampler.voices[0].(*samplerVoice)
+	voice.PlayNote(high, defaultVelocity, sampleRate)
+	left, right := make([]float64, bufferSize), make([]float64, bufferSize)
+	voice.Process(left, right)
+	for n := range left {
+		if math.IsNaN(left[n]) || math.IsInf(left[n], 0) {
+			t.Fatalf("bad sample %d: %v", n, left[n])
+		}
+	}
+	if voice.State() != stateFree {
+		t.Errorf("voice not freed after playing the sound at rate %v", voice.rate)
+	}
+}
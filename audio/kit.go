@@ -0,0 +1,125 @@
+package audio
+
+import (
+	"bufio"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// KitManifest is the name of the file that describes the layout of a kit directory.
+const KitManifest = "kit.txt"
+
+var soundExtensions = map[string]bool{
+	".wav":  true,
+	".wave": true,
+	".aif":  true,
+	".aiff": true,
+	".aifc": true,
+	".flac": true,
+	".ogg":  true,
+}
+
+// NoChoke is the choke key of a KitSound that isn't choked by another key.
+const NoChoke = -1
+
+// A KitSound is a sound in a kit, with the key it's mapped to and its key
+// properties.
+type KitSound struct {
+	Sound *Sound
+	Key   int
+	Level float64 // dB
+	Choke int     // NoChoke, or the key that stops this sound
+}
+
+// LoadKit loads the sounds in dir. When dir has a manifest, it lists a file, key,
+// and optionally a level and choke key on each line, with keys relative to
+// startKey. Without a manifest, all sound files are mapped to consecutive keys
+// from startKey in alphabetical order.
+func LoadKit(dir string, startKey int) ([]KitSound, error) {
+	kit, err := readKitManifest(dir, startKey)
+	if os.IsNotExist(err) {
+		kit, err = listKit(dir, startKey)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(kit) == 0 {
+		return nil, fmt.Errorf("no sounds found in %s", dir)
+	}
+	for n := range kit {
+		if kit[n].Key < 0 || kit[n].Key >= numKeys {
+			return nil, fmt.Errorf("key out of range for %s: %d", kit[n].Sound.file, kit[n].Key)
+		}
+		// Choke key 0 means no choke for the sampler, so it can't choke other keys
+		if c := kit[n].Choke; c != NoChoke && (c < 1 || c >= numKeys) {
+			return nil, fmt.Errorf("choke key out of range for %s: %d", kit[n].Sound.file, c)
+		}
+		file := kit[n].Sound.file
+		if kit[n].Sound, err = LoadSound(file); err != nil {
+			return nil, err
+		}
+	}
+	return kit, nil
+}
+
+func listKit(dir string, startKey int) ([]KitSound, error) {
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if !f.IsDir() && soundExtensions[strings.ToLower(filepath.Ext(f.Name()))] {
+			names = append(names, f.Name())
+		}
+	}
+	sort.Strings(names)
+	kit := make([]KitSound, len(names))
+	for n, name := range names {
+		kit[n] = KitSound{Sound: &Sound{file: filepath.Join(dir, name)}, Key: startKey + n, Choke: NoChoke}
+	}
+	return kit, nil
+}
+
+func readKitManifest(dir string, startKey int) ([]KitSound, error) {
+	f, err := os.Open(filepath.Join(dir, KitManifest))
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var kit []KitSound
+	sc := bufio.NewScanner(f)
+	for line := 1; sc.Scan(); line++ {
+		fields := strings.Fields(sc.Text())
+		if len(fields) == 0 || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || len(fields) > 4 {
+			return nil, fmt.Errorf("%s:%d: expected a file, key, level and choke", KitManifest, line)
+		}
+		ks := KitSound{Sound: &Sound{file: filepath.Join(dir, fields[0])}, Choke: NoChoke}
+		if ks.Key, err = strconv.Atoi(fields[1]); err != nil {
+			return nil, fmt.Errorf("%s:%d: invalid key: %s", KitManifest, line, fields[1])
+		}
+		ks.Key += startKey
+		if len(fields) > 2 {
+			if ks.Level, err = strconv.ParseFloat(fields[2], 64); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid level: %s", KitManifest, line, fields[2])
+			}
+		}
+		if len(fields) > 3 {
+			if ks.Choke, err = strconv.Atoi(fields[3]); err != nil {
+				return nil, fmt.Errorf("%s:%d: invalid choke key: %s", KitManifest, line, fields[3])
+			}
+			ks.Choke += startKey
+		}
+		kit = append(kit, ks)
+	}
+	return kit, sc.Err()
+}
@@ -0,0 +1,79 @@
+package audio
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestLoadKit(t *testing.T) {
+	dir, err := ioutil.TempDir("", "vibe")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	wav := wavFile(1, 16, 44100, []float64{0, 0.5}, func(v float64) []byte { return le(int16(v * 32767)) })
+	for _, name := range []string{"snare.wav", "kick.wav", "hat.flac.txt", "hat.wav"} {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), wav, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	kit, err := LoadKit(dir, 36)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"hat.wav", "kick.wav", "snare.wav"}
+	if len(kit) != len(want) {
+		t.Fatalf("wrong number of sounds: want %v, got %v", len(want), len(kit))
+	}
+	for n, ks := range kit {
+		if file := filepath.Base(ks.Sound.file); file != want[n] || ks.Key != 36+n || ks.Choke != NoChoke {
+			t.Errorf("sound %d: want %s on %d without choke, got %s on %d, choke %d", n, want[n], 36+n, file, ks.Key, ks.Choke)
+		}
+	}
+
+	manifest := "# file key level choke\nkick.wav 0\n\nhat.wav 2 -6 3\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, KitManifest), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	kit, err = LoadKit(dir, 36)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(kit) != 2 {
+		t.Fatalf("wrong number of sounds: want 2, got %v", len(kit))
+	}
+	if ks := kit[1]; ks.Key != 38 || ks.Level != -6 || ks.Choke != 39 {
+		t.Errorf("wrong hat: want key 38, level -6, choke 39, got %v, %v, %v", ks.Key, ks.Level, ks.Choke)
+	}
+	if ks := kit[0]; ks.Choke != NoChoke {
+		t.Errorf("wrong kick choke: want %v, got %v", NoChoke, ks.Choke)
+	}
+
+	// Key 0 can't choke other keys
+	manifest = "kick.wav 0\nhat.wav 2 -6 0\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, KitManifest), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadKit(dir, 0); err == nil {
+		t.Error("expected an error for choke key 0")
+	}
+}
+
+func TestSoundMappingString(t *testing.T) {
+	m := &SoundMapping{}
+	m.Put(1, &Sound{file: "kick.wav"})
+	m.AddLayer(2, 0, 63, &Sound{file: "soft.wav"})
+	m.AddLayer(2, 64, 127, &Sound{file: "hard.wav"})
+	m.PutZone(60, 48, 72, &Sound{file: "piano.wav"})
+
+	want := "1       kick.wav\n" +
+		"2       soft.wav (velocity 0-63), hard.wav (velocity 64-127)\n" +
+		"48-72   piano.wav (root 60)"
+	if got := m.String(); got != want {
+		t.Errorf("wrong listing:\nwant:\n%s\ngot:\n%s", want, got)
+	}
+}
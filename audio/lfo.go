@@ -0,0 +1,179 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sync/atomic"
+)
+
+const (
+	propLFOWave  = "wave"
+	propLFORate  = "rate"
+	propLFOSync  = "sync"
+	propLFODepth = "depth"
+	propLFOPhase = "phase"
+)
+
+// LFO is a low frequency oscillator that modulates numeric properties of other devices.
+// It's a Ticker, so its routes are updated once per buffer.
+type LFO struct {
+	*Props
+	seq    *Sequencer
+	wave   *atomic.Value
+	rate   *atomic.Value
+	sync   *atomic.Value
+	depth  *atomic.Value
+	phase  *atomic.Value
+	routes *atomic.Value // []*route, replaced on every change
+
+	// state
+	pos   float64 // position in cycles when free running
+	cycle int64   // index of the current cycle, used by sample and hold
+	held  float64 // current sample and hold value
+	rand  *rand.Rand
+}
+
+type route struct {
+	device   Device
+	prop     string
+	min, max float64
+	init     interface{} // value of the property before it was routed
+}
+
+// NewLFO creates an LFO. When the sync property is non-zero, the LFO follows the
+// sequencer and completes a cycle every sync beats, otherwise it runs at rate Hz.
+func NewLFO(props *Props, seq *Sequencer) *LFO {
+	lfo := &LFO{
+		Props:  props,
+		seq:    seq,
+		wave:   props.MustRegister(propLFOWave, setLFOWave, "sine"),
+		rate:   props.MustRegister(propLFORate, setFloat64(0.01, 50), 1.0),
+		sync:   props.MustRegister(propLFOSync, setFloat64(0, 64), 0.),
+		depth:  props.MustRegister(propLFODepth, setFloat64(0, 1), 1.0),
+		phase:  props.MustRegister(propLFOPhase, setFloat64(0, 1), 0.),
+		routes: &atomic.Value{},
+		rand:   rand.New(rand.NewSource(1)),
+	}
+	lfo.routes.Store([]*route(nil))
+	return lfo
+}
+
+// Route modulates prop on device between min and max. Routing a property again
+// replaces its range.
+func (l *LFO) Route(device Device, prop string, min, max float64) error {
+	v, err := device.Get(prop)
+	if err != nil {
+		return err
+	}
+	if _, ok := v.(float64); !ok {
+		return fmt.Errorf("property %s is not numeric", prop)
+	}
+	for _, f := range []float64{min, max} {
+		if err := device.Validate(prop, f); err != nil {
+			return err
+		}
+	}
+	r := &route{device: device, prop: prop, min: min, max: max, init: v}
+	var routes []*route
+	for _, old := range l.routes.Load().([]*route) {
+		if old.device == device && old.prop == prop {
+			r.init = old.init
+			continue
+		}
+		routes = append(routes, old)
+	}
+	l.routes.Store(append(routes, r))
+	return nil
+}
+
+// Unroute stops modulating prop on device and restores the value it had before
+// it was routed.
+func (l *LFO) Unroute(device Device, prop string) error {
+	var (
+		routes  []*route
+		removed *route
+	)
+	for _, r := range l.routes.Load().([]*route) {
+		if r.device == device && r.prop == prop {
+			removed = r
+			continue
+		}
+		routes = append(routes, r)
+	}
+	if removed == nil {
+		return fmt.Errorf("property %s is not routed", prop)
+	}
+	l.routes.Store(routes)
+	return device.Set(prop, removed.init)
+}
+
+func (l *LFO) Tick(numSamples int) {
+	routes := l.routes.Load().([]*route)
+	val := l.value(numSamples)
+	depth := l.depth.Load().(float64)
+	for _, r := range routes {
+		// Values are checked when the route is created, so this can only fail if
+		// the property range changed, in which case we skip the update.
+		r.device.Set(r.prop, r.min+(r.max-r.min)*(0.5+0.5*depth*val))
+	}
+}
+
+// value returns the LFO output in the range -1 to 1 and advances its phase.
+func (l *LFO) value(numSamples int) float64 {
+	var pos float64
+	if beats := l.sync.Load().(float64); beats > 0 {
+		pos = l.seq.position() / beats
+	} else {
+		pos = l.pos
+		l.pos += l.rate.Load().(float64) * float64(numSamples) / sampleRate
+	}
+	pos += l.phase.Load().(float64)
+	cycle := int64(math.Floor(pos))
+	wave := l.wave.Load().(string)
+	if wave == "s&h" {
+		if cycle != l.cycle {
+			l.held = 2*l.rand.Float64() - 1
+		}
+		l.cycle = cycle
+		return l.held
+	}
+	l.cycle = cycle
+	return lfoShape(wave, pos-float64(cycle))
+}
+
+// lfoShape returns the value of a periodic waveform at phase, which has to be in
+// the range [0, 1).
+func lfoShape(wave string, phase float64) float64 {
+	switch wave {
+	case "sine":
+		return math.Sin(twoPi * phase)
+	case "triangle":
+		if phase < 0.5 {
+			return 4*phase - 1
+		}
+		return 3 - 4*phase
+	case "saw":
+		return 2*phase - 1
+	case "square":
+		if phase < 0.5 {
+			return 1
+		}
+		return -1
+	}
+	return 0
+}
+
+func setLFOWave(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	switch s {
+	case "sine", "triangle", "saw", "square", "s&h":
+		dest.Store(s)
+		return nil
+	default:
+		return fmt.Errorf("not a valid lfo waveform: %v", s)
+	}
+}
@@ -0,0 +1,54 @@
+package audio
+
+import "testing"
+
+func TestLFORoute(t *testing.T) {
+	seq := NewSequencer(NewProps())
+	synth := Synth(NewProps())
+	lfo := NewLFO(NewProps(), seq)
+	if err := lfo.Set(propLFOWave, "square"); err != nil {
+		t.Fatal(err)
+	}
+	if err := lfo.Set(propLFOSync, 1.); err != nil {
+		t.Fatal(err)
+	}
+	if err := lfo.Route(synth, propCutoff, 500, 2000); err != nil {
+		t.Fatal(err)
+	}
+
+	seq.Tick(bufferSize)
+	lfo.Tick(bufferSize)
+	if want, got := 2000., mustGet(t, synth, propCutoff); want != got {
+		t.Errorf("wrong cutoff in first half of the cycle: want %v, got %v", want, got)
+	}
+
+	// Move to the second half of the beat
+	seq.Tick(sampleRate / 4)
+	lfo.Tick(bufferSize)
+	if want, got := 500., mustGet(t, synth, propCutoff); want != got {
+		t.Errorf("wrong cutoff in second half of the cycle: want %v, got %v", want, got)
+	}
+
+	if err := lfo.Unroute(synth, propCutoff); err != nil {
+		t.Fatal(err)
+	}
+	if want, got := 1000., mustGet(t, synth, propCutoff); want != got {
+		t.Errorf("cutoff not restored: want %v, got %v", want, got)
+	}
+}
+
+func TestLFORouteOutOfRange(t *testing.T) {
+	lfo := NewLFO(NewProps(), NewSequencer(NewProps()))
+	if err := lfo.Route(Synth(NewProps()), propCutoff, 0, 50_000); err == nil {
+		t.Error("expected an error for a range outside of the property limits")
+	}
+}
+
+func mustGet(t *testing.T, d Device, key string) interface{} {
+	t.Helper()
+	v, err := d.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	propCeiling = "ceiling"
+
+	lookahead = 220 // samples, about 5 ms
+)
+
+// limiter is a brickwall limiter with look-ahead. The gain for every sample is
+// the lowest gain that's needed within the look-ahead window, smoothed by a
+// moving average over the same window, so the output never exceeds the ceiling
+// and the gain changes without clicks. The output is delayed by the look-ahead.
+// The lowest gain comes from a monotonic queue, so finding it takes constant
+// time on average instead of a scan of the window.
+type limiter struct {
+	*Props
+	ceiling *atomic.Value
+	release *atomic.Value
+
+	// state
+	required [lookahead]requiredGain // increasing required gains, a ring buffer
+	head     int                     // position of the lowest required gain
+	count    int                     // number of required gains
+	time     int                     // samples processed
+	released [lookahead]float64      // gain after the release, to be averaged
+	delayed  [2][lookahead]float64   // delayed input for left and right
+	pos      int                     // position in the windows
+	gain     float64                 // gain after the release
+	sum      float64                 // sum of released
+}
+
+// requiredGain is the gain a sample needs to stay under the ceiling.
+type requiredGain struct {
+	time int
+	gain float64
+}
+
+func newLimiter(props *Props, seq *Sequencer) Effect {
+	l := &limiter{
+		Props:   props,
+		ceiling: props.MustRegister(propCeiling, setFloat64(-24, 0), -0.3),
+		release: props.MustRegister(propRelease, setFloat64(0.001, 1), 0.05),
+		gain:    1,
+		sum:     lookahead,
+	}
+	for n := range l.released {
+		l.released[n] = 1
+	}
+	return l
+}
+
+func (l *limiter) Process(samples [][]float32) {
+	ceiling := math.Pow(10, l.ceiling.Load().(float64)/20)
+	release := 1 - math.Exp(-1/(l.release.Load().(float64)*sampleRate))
+	for n := range samples[0] {
+		in := [2]float64{float64(samples[0][n]), float64(samples[1][n])}
+		peak := math.Max(math.Abs(in[0]), math.Abs(in[1]))
+		required := math.Min(1, ceiling/peak)
+
+		// Drop the gain that left the window, and the gains that can't be the
+		// lowest anymore because this sample needs less
+		if l.count > 0 && l.required[l.head].time <= l.time-lookahead {
+			l.head = (l.head + 1) % lookahead
+			l.count--
+		}
+		for l.count > 0 && l.required[(l.head+l.count-1)%lookahead].gain >= required {
+			l.count--
+		}
+		l.required[(l.head+l.count)%lookahead] = requiredGain{l.time, required}
+		l.count++
+		l.time++
+		hold := l.required[l.head].gain
+		l.gain = math.Min(hold, l.gain+(1-l.gain)*release)
+
+		l.sum += l.gain - l.released[l.pos]
+		l.released[l.pos] = l.gain
+		// The oldest sample in the window is next
+		next := (l.pos + 1) % lookahead
+		gain := l.sum / lookahead
+		for i := range in {
+			// Clamping only guards against rounding errors in the sum
+			out := clamp(l.delayed[i][next]*gain, -ceiling, ceiling)
+			l.delayed[i][l.pos] = in[i]
+			samples[i][n] = float32(out)
+		}
+		l.pos = next
+	}
+}
@@ -0,0 +1,67 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestLimiter(t *testing.T) {
+	tests := []struct {
+		name   string
+		signal func(n int) float64
+	}{
+		{"sine", func(n int) float64 { return 4 * math.Sin(twoPi*100*float64(n)/sampleRate) }},
+		{"step", func(n int) float64 {
+			if n < sampleRate/2 {
+				return 0.1
+			}
+			return 3
+		}},
+		{"clicks", func(n int) float64 {
+			if n%1000 == 0 {
+				return -8
+			}
+			return 0.5
+		}},
+	}
+	for _, test := range tests {
+		effect, _ := NewEffect("limiter", NewProps(), nil)
+		effect.Set(propCeiling, -1.)
+		ceiling := math.Pow(10, -1./20)
+
+		samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+		var peak float64
+		for pos := 0; pos < sampleRate; pos += bufferSize {
+			for n := range samples[0] {
+				v := float32(test.signal(pos + n))
+				samples[0][n], samples[1][n] = v, v/2
+			}
+			effect.Process(samples)
+			for n := range samples[0] {
+				peak = math.Max(peak, math.Abs(float64(samples[0][n])))
+			}
+		}
+		if peak > ceiling+1e-6 {
+			t.Errorf("%s: output over the ceiling: want at most %v, got %v", test.name, ceiling, peak)
+		}
+		if peak < ceiling-0.01 {
+			t.Errorf("%s: output doesn't reach the ceiling: want %v, got %v", test.name, ceiling, peak)
+		}
+	}
+}
+
+func TestMasterClips(t *testing.T) {
+	sink := newSink()
+	sink.AddSources(constant(0.5), constant(0.75))
+	samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+	sink.Process(samples)
+	if clips := sink.Master().Clips(); clips != bufferSize {
+		t.Errorf("wrong number of clips: want %v, got %v", bufferSize, clips)
+	}
+	if clips := sink.Master().Clips(); clips != 0 {
+		t.Errorf("clips were not reset: want 0, got %v", clips)
+	}
+	if peak := sink.Master().Peak(); peak > -0.3 {
+		t.Errorf("master is not limited: want at most -0.3 dB, got %v", peak)
+	}
+}
@@ -0,0 +1,209 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	PropGain = "gain"
+	PropMute = "mute"
+	PropSolo = "solo"
+)
+
+const minGain = -96.
+
+var setGain = setFloat64(minGain, 12)
+
+// A Channel is a strip of the mixer that a single source plays through. Its
+// chain holds the insert effects of the source.
+type Channel struct {
+	*Props
+	Chain
+	source Source
+	gain   *atomic.Value
+	pan    *atomic.Value
+	mute   *atomic.Value
+	solo   *atomic.Value
+	sends  *atomic.Value // []send
+	dry    [][]float32   // output of the source, which can key compressors
+	bufs   [][]float32
+	meter  meter
+}
+
+func newChannel(source Source) *Channel {
+	props := NewProps()
+	c := &Channel{
+		Props:  props,
+		Chain:  newChain(),
+		source: source,
+		gain:   props.MustRegister(PropGain, setGain, 0.),
+		pan:    props.MustRegister(PropPan, setFloat64(-1, 1), 0.),
+		mute:   props.MustRegister(PropMute, setBool, false),
+		solo:   props.MustRegister(PropSolo, setBool, false),
+		sends:  &atomic.Value{},
+		dry:    [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)},
+		bufs:   [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)},
+	}
+	c.sends.Store([]send(nil))
+	return c
+}
+
+// Send sets the level in dB at which the channel is sent to bus, after the
+// fader. Sends at the minimum gain are silent.
+func (c *Channel) Send(bus *Bus, gain float64) error {
+	sends := c.sends.Load().([]send)
+	for _, s := range sends {
+		if s.bus == bus {
+			return setGain(gain, s.gain)
+		}
+	}
+	s := send{bus: bus, gain: &atomic.Value{}}
+	if err := setGain(gain, s.gain); err != nil {
+		return err
+	}
+	c.sends.Store(append(sends[:len(sends):len(sends)], s))
+	return nil
+}
+
+// Peak returns the highest post-fader level in dBFS since the last call.
+func (c *Channel) Peak() float64 {
+	return c.meter.read()
+}
+
+// render renders the source into the dry buffers of the channel. All channels
+// are rendered before any effects run, so compressors can be keyed by any
+// channel.
+func (c *Channel) render(n int) {
+	c.dry[0], c.dry[1] = c.dry[0][:n], c.dry[1][:n]
+	for i := range c.dry {
+		for j := range c.dry[i] {
+			c.dry[i][j] = 0
+		}
+	}
+	c.source.Process(c.dry)
+}
+
+// process runs the insert effects on the rendered output.
+func (c *Channel) process() {
+	n := len(c.dry[0])
+	c.bufs[0], c.bufs[1] = c.bufs[0][:n], c.bufs[1][:n]
+	copy(c.bufs[0], c.dry[0])
+	copy(c.bufs[1], c.dry[1])
+	c.Chain.process(c.bufs)
+}
+
+// mix adds the output of the channel, after gain and pan, to samples and to the
+// buses it sends to.
+func (c *Channel) mix(samples [][]float32) {
+	gain := math.Pow(10, c.gain.Load().(float64)/20)
+	gl, gr := panGains(c.pan.Load().(float64))
+	gl, gr = gl*gain, gr*gain
+	var peak float64
+	for n := range samples[0] {
+		l, r := gl*float64(c.bufs[0][n]), gr*float64(c.bufs[1][n])
+		c.bufs[0][n], c.bufs[1][n] = float32(l), float32(r)
+		samples[0][n] += float32(l)
+		samples[1][n] += float32(r)
+		peak = math.Max(peak, math.Max(math.Abs(l), math.Abs(r)))
+	}
+	c.meter.update(peak)
+
+	for _, s := range c.sends.Load().([]send) {
+		db := s.gain.Load().(float64)
+		if db <= minGain {
+			continue
+		}
+		gain := float32(math.Pow(10, db/20))
+		for i := range s.bus.bufs {
+			for n := range s.bus.bufs[i] {
+				s.bus.bufs[i][n] += gain * c.bufs[i][n]
+			}
+		}
+	}
+}
+
+// Master is the chain of effects, the gain stage and the limiter that the mixed
+// channels pass through.
+type Master struct {
+	*Props
+	Chain
+	gain    *atomic.Value
+	limit   *atomic.Value
+	limiter Effect
+	meter   meter
+	clips   uint64 // samples over 0 dBFS before the limiter
+}
+
+const propLimiter = "limiter"
+
+func newMaster() *Master {
+	props := NewProps()
+	return &Master{
+		Props:   props,
+		Chain:   newChain(),
+		gain:    props.MustRegister(PropGain, setGain, 0.),
+		limit:   props.MustRegister(propLimiter, setBool, true),
+		limiter: newLimiter(props, nil),
+	}
+}
+
+// Peak returns the highest output level in dBFS since the last call.
+func (m *Master) Peak() float64 {
+	return m.meter.read()
+}
+
+// Clips returns the number of samples since the last call that were over 0 dBFS
+// before the limiter, and would clip without it.
+func (m *Master) Clips() int {
+	return int(atomic.SwapUint64(&m.clips, 0))
+}
+
+func (m *Master) process(samples [][]float32) {
+	m.Chain.process(samples)
+	gain := float32(math.Pow(10, m.gain.Load().(float64)/20))
+	var clips uint64
+	for n := range samples[0] {
+		samples[0][n] *= gain
+		samples[1][n] *= gain
+		if math.Max(math.Abs(float64(samples[0][n])), math.Abs(float64(samples[1][n]))) > 1 {
+			clips++
+		}
+	}
+	atomic.AddUint64(&m.clips, clips)
+	if m.limit.Load().(bool) {
+		m.limiter.Process(samples)
+	}
+	var peak float32
+	for i := range samples {
+		for n := range samples[i] {
+			if v := samples[i][n]; v > peak {
+				peak = v
+			} else if -v > peak {
+				peak = -v
+			}
+		}
+	}
+	m.meter.update(float64(peak))
+}
+
+// meter holds the peak level since it was last read. It's updated by the audio
+// thread and read by any other goroutine.
+type meter struct {
+	peak uint64 // float64 bits
+}
+
+func (m *meter) update(peak float64) {
+	for {
+		old := atomic.LoadUint64(&m.peak)
+		if math.Float64frombits(old) >= peak || atomic.CompareAndSwapUint64(&m.peak, old, math.Float64bits(peak)) {
+			return
+		}
+	}
+}
+
+// read returns the peak in dBFS and resets it.
+func (m *meter) read() float64 {
+	peak := math.Float64frombits(atomic.SwapUint64(&m.peak, 0))
+	return 20 * math.Log10(peak)
+}
@@ -0,0 +1,133 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// constant outputs the same value on both channels.
+type constant float32
+
+func (c constant) Process(samples [][]float32) {
+	for i := range samples[0] {
+		samples[0][i] += float32(c)
+		samples[1][i] += float32(c)
+	}
+}
+
+// newTestSink returns a sink without the master limiter, which would delay and
+// limit the output.
+func newTestSink() *Sink {
+	sink := newSink()
+	sink.Master().Set(propLimiter, false)
+	return sink
+}
+
+func TestMixer(t *testing.T) {
+	tests := []struct {
+		name        string
+		set         func(a, b *Channel, m *Master)
+		left, right float64
+	}{
+		{"sum", func(a, b *Channel, m *Master) {}, 0.75, 0.75},
+		{"gain", func(a, b *Channel, m *Master) { a.Set(PropGain, -6.) }, 0.5 + 0.25*math.Pow(10, -6./20), 0.5 + 0.25*math.Pow(10, -6./20)},
+		{"pan", func(a, b *Channel, m *Master) { a.Set(PropPan, -1.) }, 0.75, 0.5},
+		{"pan right", func(a, b *Channel, m *Master) { b.Set(PropPan, 0.5) }, 0.25 + 0.5/(1+math.Sqrt2), 0.75},
+		{"mute", func(a, b *Channel, m *Master) { b.Set(PropMute, true) }, 0.25, 0.25},
+		{"solo", func(a, b *Channel, m *Master) { a.Set(PropSolo, true) }, 0.25, 0.25},
+		{"solo and mute", func(a, b *Channel, m *Master) {
+			a.Set(PropSolo, true)
+			a.Set(PropMute, true)
+		}, 0, 0},
+		{"master", func(a, b *Channel, m *Master) { m.Set(PropGain, 6.) }, 0.75 * math.Pow(10, 6./20), 0.75 * math.Pow(10, 6./20)},
+	}
+	for _, test := range tests {
+		sink := newTestSink()
+		a, b := constant(0.25), constant(0.5)
+		sink.AddSources(a, b)
+		test.set(sink.Channel(a), sink.Channel(b), sink.Master())
+
+		samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+		sink.Process(samples)
+		if l, r := float64(samples[0][0]), float64(samples[1][0]); math.Abs(l-test.left) > 1e-6 || math.Abs(r-test.right) > 1e-6 {
+			t.Errorf("%s: want %v, %v, got %v, %v", test.name, test.left, test.right, l, r)
+		}
+	}
+}
+
+func TestMeters(t *testing.T) {
+	sink := newTestSink()
+	a := constant(0.5)
+	sink.AddSources(a)
+	sink.Channel(a).Set(PropGain, -6.)
+	sink.Master().Set(PropGain, -6.)
+
+	samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+	sink.Process(samples)
+	want := 20*math.Log10(0.5) - 6
+	if got := sink.Channel(a).Peak(); math.Abs(got-want) > 1e-3 {
+		t.Errorf("wrong channel peak: want %v, got %v", want, got)
+	}
+	if got := sink.Master().Peak(); math.Abs(got-(want-6)) > 1e-3 {
+		t.Errorf("wrong master peak: want %v, got %v", want-6, got)
+	}
+	if got := sink.Master().Peak(); !math.IsInf(got, -1) {
+		t.Errorf("peak was not reset: want -Inf, got %v", got)
+	}
+}
+
+// double is an effect that doubles its input.
+type double struct {
+	*Props
+}
+
+func (d double) Process(samples [][]float32) {
+	for i := range samples {
+		for n := range samples[i] {
+			samples[i][n] *= 2
+		}
+	}
+}
+
+func TestBus(t *testing.T) {
+	sink := newTestSink()
+	a, b := constant(0.25), constant(0.5)
+	sink.AddSources(a, b)
+	bus := sink.AddBus()
+	bus.Add(double{NewProps()})
+
+	send := func(c Source, gain float64) {
+		if err := sink.Channel(c).Send(bus, gain); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		name string
+		set  func()
+		want float64
+	}{
+		{"no sends", func() {}, 0.75},
+		{"send", func() { send(a, 0) }, 0.75 + 0.5},
+		{"post fader", func() { sink.Channel(a).Set(PropGain, -6.) }, 0.5 + 0.25*math.Pow(10, -6./20)*3},
+		{"return gain", func() { bus.Set(PropGain, minGain) }, 0.5 + 0.25*math.Pow(10, -6./20)*(1+2*math.Pow(10, minGain/20))},
+		{"send off", func() {
+			bus.Set(PropGain, 0.)
+			send(a, minGain)
+		}, 0.5 + 0.25*math.Pow(10, -6./20)},
+		{"muted", func() {
+			send(b, -6)
+			sink.Channel(b).Set(PropMute, true)
+		}, 0.25 * math.Pow(10, -6./20)},
+	}
+	samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+	for _, test := range tests {
+		test.set()
+		sink.Process(samples)
+		if got := float64(samples[0][0]); math.Abs(got-test.want) > 1e-6 {
+			t.Errorf("%s: want %v, got %v", test.name, test.want, got)
+		}
+	}
+	if err := sink.Channel(a).Send(bus, 20); err == nil {
+		t.Error("expected an error for a send above the maximum gain")
+	}
+}
@@ -0,0 +1,165 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"sync/atomic"
+)
+
+const numModSlots = 8
+
+type modSource int
+
+const (
+	modSourceOff modSource = iota
+	modSourceFEnv
+	modSourceEnv2
+	modSourceLFO1
+	modSourceLFO2
+	modSourceVelocity
+	modSourceKey
+	modSourceModWheel
+	numModSources
+)
+
+var modSourceNames = [numModSources]string{
+	modSourceOff:      "off",
+	modSourceFEnv:     "fenv",
+	modSourceEnv2:     "env2",
+	modSourceLFO1:     "lfo1",
+	modSourceLFO2:     "lfo2",
+	modSourceVelocity: "velocity",
+	modSourceKey:      "key",
+	modSourceModWheel: "modwheel",
+}
+
+func (s modSource) String() string { return modSourceNames[s] }
+
+type modDest int
+
+// The unit of a modulation amount depends on its destination:
+//
+//	cutoff:         octaves
+//	resonance:      added to the filter q
+//	pitch:          semitones
+//	amp:            gain factor, added to a base gain of 1
+//	mix:            added to the oscillator mix, from 0 (osc1) to 1 (osc2)
+//	osc1.table.pos: added to the wavetable position of osc1, from 0 to 1
+//	osc2.table.pos: added to the wavetable position of osc2
+//	pw:             added to the pulse width of both oscillators
+const (
+	modDestOff modDest = iota
+	modDestCutoff
+	modDestResonance
+	modDestPitch
+	modDestAmp
+	modDestMix
+	modDestOsc1Pos
+	modDestOsc2Pos
+	modDestPulseWidth
+	numModDests
+)
+
+var modDestNames = [numModDests]string{
+	modDestOff:        "off",
+	modDestCutoff:     "cutoff",
+	modDestResonance:  "resonance",
+	modDestPitch:      "pitch",
+	modDestAmp:        "amp",
+	modDestMix:        "mix",
+	modDestOsc1Pos:    "osc1.table.pos",
+	modDestOsc2Pos:    "osc2.table.pos",
+	modDestPulseWidth: "pw",
+}
+
+func (d modDest) String() string { return modDestNames[d] }
+
+// modSlot is a single row in the modulation matrix of a synth.
+type modSlot struct {
+	source *atomic.Value
+	dest   *atomic.Value
+	amount *atomic.Value
+}
+
+// registerModSlots adds the properties for the modulation matrix. Slots are
+// numbered from 1 and configured with mod.N.source, mod.N.dest and mod.N.amount.
+func registerModSlots(props *Props) []modSlot {
+	slots := make([]modSlot, numModSlots)
+	for n := range slots {
+		prefix := "mod." + strconv.Itoa(n+1) + "."
+		slots[n] = modSlot{
+			source: props.MustRegister(prefix+"source", setModSource, "off"),
+			dest:   props.MustRegister(prefix+"dest", setModDest, "off"),
+			amount: props.MustRegister(prefix+"amount", setFloat64(-100, 100), 0.),
+		}
+	}
+	return slots
+}
+
+// modMatrix sums the contributions of all slots for each destination.
+func modMatrix(slots []modSlot, sources *[numModSources]float64) (mods [numModDests]float64) {
+	for _, slot := range slots {
+		src := slot.source.Load().(modSource)
+		dest := slot.dest.Load().(modDest)
+		if src == modSourceOff || dest == modDestOff {
+			continue
+		}
+		mods[dest] += slot.amount.Load().(float64) * sources[src]
+	}
+	return mods
+}
+
+// voiceLFO is a free running LFO that is restarted for every note.
+type voiceLFO struct {
+	wave  *atomic.Value
+	rate  *atomic.Value
+	phase float64
+}
+
+func (l *voiceLFO) reset() {
+	l.phase = 0
+}
+
+// next returns the current value and advances the LFO by n samples.
+func (l *voiceLFO) next(n int) float64 {
+	val := lfoShape(l.wave.Load().(string), l.phase)
+	l.phase += l.rate.Load().(float64) * float64(n) / sampleRate
+	l.phase -= math.Floor(l.phase)
+	return val
+}
+
+func setModSource(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	for n, name := range modSourceNames {
+		if name == s {
+			dest.Store(modSource(n))
+			return nil
+		}
+	}
+	return fmt.Errorf("not a valid modulation source: %v", s)
+}
+
+func setModDest(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	for n, name := range modDestNames {
+		if name == s {
+			dest.Store(modDest(n))
+			return nil
+		}
+	}
+	return fmt.Errorf("not a valid modulation destination: %v", s)
+}
+
+func setVoiceLFOWave(v interface{}, dest *atomic.Value) error {
+	if s, ok := v.(string); ok && s == "s&h" {
+		return fmt.Errorf("sample and hold is not supported for voice lfos")
+	}
+	return setLFOWave(v, dest)
+}
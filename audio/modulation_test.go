@@ -0,0 +1,49 @@
+package audio
+
+import "testing"
+
+func TestModMatrix(t *testing.T) {
+	props := NewProps()
+	slots := registerModSlots(props)
+	for key, val := range map[string]interface{}{
+		"mod.1.source": "velocity",
+		"mod.1.dest":   "cutoff",
+		"mod.1.amount": 2.,
+		"mod.2.source": "key",
+		"mod.2.dest":   "cutoff",
+		"mod.2.amount": 0.5,
+		"mod.3.source": "lfo1",
+		"mod.3.dest":   "pitch",
+		"mod.3.amount": 12.,
+	} {
+		if err := props.Set(key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var sources [numModSources]float64
+	sources[modSourceVelocity] = 0.5
+	sources[modSourceKey] = 2
+	sources[modSourceLFO1] = -1
+
+	mods := modMatrix(slots, &sources)
+	if want, got := 2., mods[modDestCutoff]; want != got {
+		t.Errorf("wrong cutoff modulation: want %v, got %v", want, got)
+	}
+	if want, got := -12., mods[modDestPitch]; want != got {
+		t.Errorf("wrong pitch modulation: want %v, got %v", want, got)
+	}
+	if want, got := 0., mods[modDestAmp]; want != got {
+		t.Errorf("wrong amp modulation: want %v, got %v", want, got)
+	}
+}
+
+func TestModSlotValidation(t *testing.T) {
+	props := NewProps()
+	registerModSlots(props)
+	if err := props.Set("mod.1.source", "wobble"); err == nil {
+		t.Error("expected an error for an unknown source")
+	}
+	if err := props.Set("mod.9.dest", "cutoff"); err == nil {
+		t.Error("expected an error for a slot that doesn't exist")
+	}
+}
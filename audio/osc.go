@@ -0,0 +1,184 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"sync/atomic"
+)
+
+const twoPi = 2 * math.Pi
+
+type waveform int
+
+const (
+	waveOff waveform = iota
+	waveSine
+	waveSaw
+	waveSquare
+	waveTriangle
+	waveNaiveSaw
+	waveNaiveSquare
+	waveNaiveTriangle
+	waveTable
+)
+
+var waveforms = map[string]waveform{
+	"off":            waveOff,
+	"sine":           waveSine,
+	"saw":            waveSaw,
+	"square":         waveSquare,
+	"triangle":       waveTriangle,
+	"naive-saw":      waveNaiveSaw,
+	"naive-square":   waveNaiveSquare,
+	"naive-triangle": waveNaiveTriangle,
+	"table":          waveTable,
+}
+
+// osc is an oscillator. The saw, square and triangle waveforms are band-limited
+// using polynomial approximations of a band-limited step (PolyBLEP) or ramp
+// (PolyBLAMP). The naive variants are computed straight from the phase and alias
+// at high frequencies. The table waveform plays a wavetable.
+type osc struct {
+	wave       waveform
+	phase      float64 // normalized phase in the range [0, 1)
+	phaseDelta float64 // frequency divided by the sample rate
+	pulseWidth float64
+	table      *wavetable
+	tablePos   float64
+
+	// Hard sync: if resets is set, process stores the position of every wrap of the
+	// phase as a fraction of a sample, or -1 if the phase didn't wrap. An oscillator
+	// with syncTo set restarts its cycle at those positions.
+	resets []float64
+	syncTo []float64
+}
+
+// maxPhaseDelta is the phase delta at Nyquist. Extreme tuning and pitch
+// modulation can ask for higher frequencies, which would only alias.
+const maxPhaseDelta = 0.5
+
+func (o *osc) process(buf []float64, level float64) {
+	o.phaseDelta = math.Min(o.phaseDelta, maxPhaseDelta)
+	dt := o.phaseDelta
+	if o.wave == waveTable {
+		o.processTable(buf, level)
+		return
+	}
+	for n := range buf {
+		t := o.phase
+		var val float64
+		switch o.wave {
+		case waveSine:
+			val = math.Sin(twoPi * t)
+		case waveSaw:
+			val = 2*t - 1 - polyBLEP(t, dt)
+		case waveSquare:
+			pw := o.pulseWidth
+			val = naiveSquare(t, pw) + polyBLEP(t, dt) - polyBLEP(wrap(t+1-pw), dt)
+		case waveTriangle:
+			val = naiveTriangle(t) + 4*dt*(polyBLAMP(t, dt)-polyBLAMP(wrap(t+0.5), dt))
+		case waveNaiveSaw:
+			val = 2*t - 1
+		case waveNaiveSquare:
+			val = naiveSquare(t, o.pulseWidth)
+		case waveNaiveTriangle:
+			val = naiveTriangle(t)
+		}
+		buf[n] += level * val
+		o.advance(n)
+	}
+}
+
+// advance moves the phase forward by one sample, taking hard sync into account.
+func (o *osc) advance(n int) {
+	o.phase += o.phaseDelta
+	if o.syncTo != nil && o.syncTo[n] >= 0 {
+		o.phase = o.syncTo[n] * o.phaseDelta
+	}
+	if o.phase >= 1 {
+		o.phase -= math.Floor(o.phase)
+		if o.resets != nil {
+			o.resets[n] = o.phase / o.phaseDelta
+		}
+	} else if o.resets != nil {
+		o.resets[n] = -1
+	}
+}
+
+func (o *osc) processTable(buf []float64, level float64) {
+	if o.table == nil {
+		for n := range buf {
+			o.advance(n)
+		}
+		return
+	}
+	mip := o.table.level(o.phaseDelta)
+	for n := range buf {
+		buf[n] += level * o.table.value(mip, o.tablePos, o.phase)
+		o.advance(n)
+	}
+}
+
+func (o *osc) setWaveform(s string) {
+	o.wave = waveforms[s]
+}
+
+// naiveSquare returns a pulse wave without DC offset for pulse width pw.
+func naiveSquare(t, pw float64) float64 {
+	if t < pw {
+		return 1 - (2*pw - 1)
+	}
+	return -1 - (2*pw - 1)
+}
+
+// naiveTriangle starts at -1 and peaks halfway through the cycle.
+func naiveTriangle(t float64) float64 {
+	if t < 0.5 {
+		return 4*t - 1
+	}
+	return 3 - 4*t
+}
+
+// polyBLEP returns the correction for a unit step at phase 0, where t is the
+// current phase and dt the phase increment per sample.
+func polyBLEP(t, dt float64) float64 {
+	if t < dt {
+		t /= dt
+		return t + t - t*t - 1
+	}
+	if t > 1-dt {
+		t = (t - 1) / dt
+		return t*t + t + t + 1
+	}
+	return 0
+}
+
+// polyBLAMP returns the correction for a change in slope at phase 0. The result
+// has to be scaled by half the change in slope per sample.
+func polyBLAMP(t, dt float64) float64 {
+	if t < dt {
+		t = t/dt - 1
+		return -t * t * t / 3
+	}
+	if t > 1-dt {
+		t = (t-1)/dt + 1
+		return t * t * t / 3
+	}
+	return 0
+}
+
+func wrap(t float64) float64 {
+	return t - math.Floor(t)
+}
+
+func setWaveform(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	if _, ok := waveforms[s]; !ok {
+		return fmt.Errorf("not a valid waveform type: %v", s)
+	}
+	dest.Store(s)
+	return nil
+}
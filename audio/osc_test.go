@@ -0,0 +1,131 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestFFT(t *testing.T) {
+	const size = 64
+	x := make([]complex128, size)
+	for n := range x {
+		x[n] = complex(math.Cos(twoPi*4*float64(n)/size), 0)
+	}
+	fft(x)
+	for n, c := range x {
+		want := 0.
+		if n == 4 || n == size-4 {
+			want = size / 2
+		}
+		if math.Abs(cmplx.Abs(c)-want) > 1e-9 {
+			t.Errorf("bin %d: want magnitude %v, got %v", n, want, cmplx.Abs(c))
+		}
+	}
+	ifft(x)
+	for n, c := range x {
+		if want := math.Cos(twoPi * 4 * float64(n) / size); math.Abs(real(c)-want) > 1e-9 {
+			t.Errorf("sample %d after inverse: want %v, got %v", n, want, real(c))
+		}
+	}
+}
+
+func TestOscAliasing(t *testing.T) {
+	const freq = 2793.83 // F7
+	type test struct {
+		bandLimited string
+		naive       string
+	}
+	tests := []test{
+		{"saw", "naive-saw"},
+		{"square", "naive-square"},
+		{"triangle", "naive-triangle"},
+	}
+	for _, test := range tests {
+		bl := aliasing(test.bandLimited, freq)
+		naive := aliasing(test.naive, freq)
+		t.Logf("%s: %.1f dB, %s: %.1f dB", test.bandLimited, bl, test.naive, naive)
+		if bl > naive-10 {
+			t.Errorf("%s: aliasing not reduced enough: %.1f dB vs %.1f dB for %s",
+				test.bandLimited, bl, naive, test.naive)
+		}
+	}
+}
+
+// aliasing renders a waveform and returns the ratio in dB between the energy of
+// the spectrum outside of the harmonics of freq and the total energy.
+func aliasing(wave string, freq float64) float64 {
+	const size = 1 << 15
+	o := &osc{phaseDelta: freq / sampleRate}
+	o.setWaveform(wave)
+	buf := make([]float64, size)
+	o.process(buf, 1)
+
+	x := make([]complex128, size)
+	for n := range buf {
+		// Blackman-Harris window
+		p := twoPi * float64(n) / size
+		w := 0.35875 - 0.48829*math.Cos(p) + 0.14128*math.Cos(2*p) - 0.01168*math.Cos(3*p)
+		x[n] = complex(buf[n]*w, 0)
+	}
+	fft(x)
+
+	const binWidth = float64(sampleRate) / size
+	const lobe = 6 // number of bins on either side of a harmonic that belong to it
+	var total, alias float64
+	for n := 1; n < size/2; n++ {
+		power := real(x[n])*real(x[n]) + imag(x[n])*imag(x[n])
+		total += power
+		f := float64(n) * binWidth
+		harmonic := math.Round(f / freq)
+		if harmonic == 0 || math.Abs(f-harmonic*freq) > lobe*binWidth {
+			alias += power
+		}
+	}
+	return 10 * math.Log10(alias/total)
+}
+
+func TestOscHardSync(t *testing.T) {
+	const period = 100 // samples
+	master := &osc{wave: waveNaiveSaw, phaseDelta: 1. / period, resets: make([]float64, 4*period)}
+	slave := &osc{wave: waveNaiveSaw, phaseDelta: 2.7 / period, syncTo: master.resets}
+
+	buf := make([]float64, 4*period)
+	master.process(buf, 0)
+	slave.process(buf, 1)
+
+	// Without sync the slave wouldn't repeat every period of the master
+	for n := 2 * period; n < 3*period; n++ {
+		if math.Abs(buf[n]-buf[n+period]) > 1e-9 {
+			t.Fatalf("slave is not synced to master at sample %d: %v != %v", n, buf[n], buf[n+period])
+		}
+	}
+}
+
+func TestOscExtremeTuning(t *testing.T) {
+	cycle := make([]float64, 600)
+	for n := range cycle {
+		cycle[n] = 2*float64(n)/600 - 1
+	}
+	table := &wavetable{frames: [][tableLevels][]float64{mipmap(cycle)}}
+
+	// A high note with octave +3 and coarse +24 runs far above the sample rate
+	phaseDelta := 12_000. * 8 * 4 / sampleRate
+	for name, wave := range waveforms {
+		master := &osc{wave: wave, table: table, phaseDelta: phaseDelta, resets: make([]float64, bufferSize)}
+		slave := &osc{wave: wave, table: table, phaseDelta: 2.7 * phaseDelta, syncTo: master.resets}
+		buf := make([]float64, bufferSize)
+		master.process(buf, 1)
+		slave.process(buf, 1)
+		for _, o := range []*osc{master, slave} {
+			if o.phase < 0 || o.phase >= 1 {
+				t.Errorf("%s: phase out of range: %v", name, o.phase)
+			}
+		}
+		for n, v := range buf {
+			if math.IsNaN(v) || math.Abs(v) > 4 {
+				t.Fatalf("%s: bad sample %d: %v", name, n, v)
+			}
+		}
+	}
+}
@@ -5,6 +5,7 @@ import "fmt"
 type Device interface {
 	Set(key string, val interface{}) error
 	Get(key string) (interface{}, error)
+	Validate(key string, val interface{}) error
 }
 
 type preset map[string]interface{}
@@ -18,13 +19,90 @@ var presets = map[string]preset{
 		"osc2.wave":   "saw",
 		"cutoff":      900.0,
 	},
+	"acid": preset{
+		"level":        3.,
+		"env.decay":    0.2,
+		"env.sustain":  0.3,
+		"osc1.wave":    "saw",
+		"osc2.wave":    "off",
+		"cutoff":       300.0,
+		"resonance":    8.,
+		"filter.slope": 24,
+		"fenv.decay":   0.2,
+		"fenv.amount":  4.,
+	},
+	"supersaw": preset{
+		"level":         3.,
+		"env.attack":    0.2,
+		"env.release":   0.5,
+		"osc1.wave":     "saw",
+		"osc2.wave":     "saw",
+		"osc2.octave":   1,
+		"osc2.level":    0.5,
+		"cutoff":        3000.0,
+		"unison":        7,
+		"unison.detune": 25.,
+		"unison.width":  1.,
+	},
+	"e-piano": preset{
+		"algorithm":       5,
+		"op1.level":       1.,
+		"op1.env.decay":   2.,
+		"op1.env.sustain": 0.,
+		"op2.ratio":       14.,
+		"op2.level":       0.2,
+		"op2.env.decay":   0.3,
+		"op2.env.sustain": 0.,
+		"op3.level":       1.,
+		"op3.env.decay":   1.5,
+		"op3.env.sustain": 0.,
+		"op4.level":       0.3,
+		"op4.env.decay":   1.,
+		"op4.env.sustain": 0.,
+	},
+	"bell": preset{
+		"algorithm":       5,
+		"op1.level":       1.,
+		"op1.env.decay":   4.,
+		"op1.env.sustain": 0.,
+		"op2.ratio":       3.5,
+		"op2.level":       0.6,
+		"op2.env.decay":   3.,
+		"op2.env.sustain": 0.,
+		"op3.ratio":       2.,
+		"op3.level":       0.6,
+		"op3.env.decay":   3.,
+		"op3.env.sustain": 0.,
+		"op4.ratio":       7.1,
+		"op4.level":       0.4,
+		"op4.env.decay":   2.,
+		"op4.env.sustain": 0.,
+	},
+	"pluck-bass": preset{
+		"level":       3.,
+		"env.decay":   0.3,
+		"env.sustain": 0.,
+		"osc1.wave":   "saw",
+		"osc2.wave":   "square",
+		"cutoff":      150.0,
+		"resonance":   2.,
+		"fenv.decay":  0.08,
+		"fenv.amount": 5.,
+	},
 }
 
+// LoadPreset sets the properties of preset name on d. Nothing is changed unless
+// all properties are valid for the device.
 func LoadPreset(name string, d Device) error {
 	p, ok := presets[name]
 	if !ok {
 		return fmt.Errorf("unknown preset: %v", name)
 	}
+	for k, v := range p {
+		if err := d.Validate(k, v); err != nil {
+			return err
+		}
+	}
 	for k, v := range p {
 		if err := d.Set(k, v); err != nil {
 			return err
@@ -0,0 +1,24 @@
+package audio
+
+import "testing"
+
+func TestPresets(t *testing.T) {
+	for name := range presets {
+		synthErr := LoadPreset(name, Synth(NewProps()))
+		fmErr := LoadPreset(name, FM(NewProps()))
+		if synthErr != nil && fmErr != nil {
+			t.Errorf("preset %s can't be loaded: synth: %v, fm: %v", name, synthErr, fmErr)
+		}
+	}
+}
+
+func TestPresetValidation(t *testing.T) {
+	// The fm synth has no filter, so the acid preset doesn't apply
+	fm := FM(NewProps())
+	if err := LoadPreset("acid", fm); err == nil {
+		t.Fatal("expected an error for a preset of another synth")
+	}
+	if level, _ := fm.Get("level"); level != 0.1 {
+		t.Errorf("preset was partially applied: want level 0.1, got %v", level)
+	}
+}
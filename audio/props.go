@@ -35,6 +35,19 @@ func (p *Props) Set(key string, value interface{}) error {
 	return nil
 }
 
+// Validate checks whether value is valid for the property without updating it.
+func (p *Props) Validate(key string, value interface{}) error {
+	set, ok := p.setters[key]
+	if !ok {
+		return fmt.Errorf("unknown property %s", key)
+	}
+	var scratch atomic.Value
+	if err := set(value, &scratch); err != nil {
+		return fmt.Errorf("property %s: %w", key, err)
+	}
+	return nil
+}
+
 func (p *Props) Get(key string) (interface{}, error) {
 	prop, ok := p.properties[key]
 	if !ok {
@@ -97,6 +110,50 @@ func setInt(v interface{}, dest *atomic.Value) error {
 	return nil
 }
 
+func setIntRange(min, max int) setter {
+	return func(v interface{}, dest *atomic.Value) error {
+		var n int
+		switch i := v.(type) {
+		case float64:
+			n = int(i)
+		case int:
+			n = i
+		default:
+			return fmt.Errorf("value is not an int: %v", v)
+		}
+		if n < min || n > max {
+			return fmt.Errorf("property value is not in valid range %v - %v: %v", min, max, n)
+		}
+		dest.Store(n)
+		return nil
+	}
+}
+
+// setBool accepts booleans, the numbers 0 and 1, and the strings on and off.
+func setBool(v interface{}, dest *atomic.Value) error {
+	switch b := v.(type) {
+	case bool:
+		dest.Store(b)
+		return nil
+	case float64:
+		if b == 0 || b == 1 {
+			dest.Store(b == 1)
+			return nil
+		}
+	case int:
+		if b == 0 || b == 1 {
+			dest.Store(b == 1)
+			return nil
+		}
+	case string:
+		if b == "on" || b == "off" {
+			dest.Store(b == "on")
+			return nil
+		}
+	}
+	return fmt.Errorf("value is not a boolean: %v", v)
+}
+
 func setString(v interface{}, dest *atomic.Value) error {
 	if s, ok := v.(string); ok {
 		dest.Store(s)
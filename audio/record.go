@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+)
+
+const (
+	beatsPerBar  = 4
+	maxRecording = 2 * 60 // seconds
+)
+
+// A Recording captures the output of a source, or of the sink itself, for a
+// number of bars. It starts at the next bar of the sequencer.
+type Recording struct {
+	seq    *Sequencer
+	source Source // nil for the output of the sink
+	beats  float64
+	bufs   [2][]float64
+	// These are only used from the audio thread.
+	start     float64 // beat at which the recording starts, or -1 if it's not known yet
+	pos       int
+	finished  bool
+	truncated bool
+	done      chan *Sound
+}
+
+// Record starts a recording of the given number of bars. The recorded sound is
+// sent on the returned channel when the recording is done.
+func (s *Sink) Record(seq *Sequencer, source Source, bars int) (*Recording, <-chan *Sound, error) {
+	if bars < 1 {
+		return nil, nil, fmt.Errorf("invalid number of bars: %d", bars)
+	}
+	bpm := seq.tempo()
+	if bpm <= 0 {
+		return nil, nil, fmt.Errorf("can't record at %v bpm", bpm)
+	}
+	beats := float64(bars * beatsPerBar)
+	seconds := beats * 60 / bpm
+	if seconds > maxRecording {
+		return nil, nil, fmt.Errorf("recording is longer than %d seconds: %v bars at %v bpm", maxRecording, bars, bpm)
+	}
+	// Leave room for a slower tempo while recording
+	length := int(math.Min(1.25*seconds, maxRecording) * sampleRate)
+	r := &Recording{
+		seq:    seq,
+		source: source,
+		beats:  beats,
+		bufs:   [2][]float64{make([]float64, length), make([]float64, length)},
+		start:  -1,
+		done:   make(chan *Sound, 1),
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.recordings.Load().([]*Recording)
+	s.recordings.Store(append(old[:len(old):len(old)], r))
+	return r, r.done, nil
+}
+
+// Truncated reports whether the recording ran out of space before the last bar,
+// because the tempo dropped while recording. It's only valid once the recorded
+// sound has been received.
+func (r *Recording) Truncated() bool {
+	return r.truncated
+}
+
+// StopRecording removes a recording from the sink.
+func (s *Sink) StopRecording(r *Recording) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	old := s.recordings.Load().([]*Recording)
+	var recordings []*Recording
+	for _, rec := range old {
+		if rec != r {
+			recordings = append(recordings, rec)
+		}
+	}
+	s.recordings.Store(recordings)
+}
+
+// process records samples. It's called after the sequencer has moved past the
+// buffer, and follows the beats of the sequencer rather than the exact tempo, so
+// the recording stays in sync when it's played back in a loop.
+func (r *Recording) process(samples [][]float32) {
+	if r.finished {
+		return
+	}
+	from, to := r.seq.lastTick()
+	if r.start < 0 {
+		r.start = math.Ceil(from/beatsPerBar) * beatsPerBar
+	}
+	end := r.start + r.beats
+	if r.start >= to || from >= to {
+		return
+	}
+	n := len(samples[0])
+	offset := func(beat float64) int {
+		return int(math.Max(0, math.Min(1, (beat-from)/(to-from))) * float64(n))
+	}
+	for i := offset(r.start); i < offset(end) && r.pos < len(r.bufs[0]); i++ {
+		r.bufs[0][r.pos] = float64(samples[0][i])
+		r.bufs[1][r.pos] = float64(samples[1][i])
+		r.pos++
+	}
+	if end <= to || r.pos == len(r.bufs[0]) {
+		r.finished = true
+		r.truncated = end > to
+		bufs := [2][]float64{r.bufs[0][:r.pos], r.bufs[1][:r.pos]}
+		r.done <- &Sound{bufs: bufs, file: "<recording>", loop: loopOff, sampleRate: sampleRate}
+	}
+}
@@ -0,0 +1,111 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// counter outputs the number of samples it has processed.
+type counter struct {
+	n int
+}
+
+func (c *counter) Process(samples [][]float32) {
+	for i := range samples[0] {
+		samples[0][i] += float32(c.n)
+		samples[1][i] -= float32(c.n)
+		c.n++
+	}
+}
+
+func TestRecording(t *testing.T) {
+	for _, source := range []string{"master", "device"} {
+		seq := NewSequencer(NewProps())
+		sink := newTestSink()
+		sink.AddTicker(seq)
+		c := &counter{}
+		sink.AddSources(c)
+
+		// Start recording after the first beat, so it waits for the second bar
+		samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+		for n := 0; n < sampleRate/2/bufferSize; n++ {
+			sink.Process(samples)
+		}
+		var src Source
+		if source == "device" {
+			src = c
+		}
+		_, done, err := sink.Record(seq, src, 1)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var snd *Sound
+		for n := 0; n < 10*sampleRate/bufferSize && snd == nil; n++ {
+			sink.Process(samples)
+			select {
+			case snd = <-done:
+			default:
+			}
+		}
+		if snd == nil {
+			t.Fatalf("%s: recording didn't finish", source)
+		}
+
+		// The sequencer moves a whole number of pulses per buffer, so at 120 bpm
+		// its bars are slightly longer than 2 seconds.
+		pulses := math.Floor(PPQN * 2 / (sampleRate / bufferSize))
+		bar := 4 * PPQN / pulses * bufferSize
+		if math.Abs(float64(snd.len())-bar) > 1 {
+			t.Errorf("%s: wrong length: want %v, got %v", source, bar, snd.len())
+		}
+		if start := snd.bufs[0][0]; math.Abs(start-bar) > 1 {
+			t.Errorf("%s: recording didn't start at the second bar: want %v, got %v", source, bar, start)
+		}
+		for n := 1; n < snd.len(); n++ {
+			if snd.bufs[0][n] != snd.bufs[0][n-1]+1 || snd.bufs[1][n] != -snd.bufs[0][n] {
+				t.Fatalf("%s: recording is not continuous at %d", source, n)
+			}
+		}
+	}
+}
+
+func TestRecordingLimits(t *testing.T) {
+	seq := NewSequencer(NewProps())
+	sink := newTestSink()
+	sink.AddTicker(seq)
+	for _, bpm := range []float64{0, 1} {
+		if err := seq.Set("bpm", bpm); err != nil {
+			t.Fatal(err)
+		}
+		if _, _, err := sink.Record(seq, nil, 4); err == nil {
+			t.Errorf("%v bpm: expected an error", bpm)
+		}
+	}
+
+	// Halving the tempo while recording runs out of space
+	if err := seq.Set("bpm", 120.); err != nil {
+		t.Fatal(err)
+	}
+	rec, done, err := sink.Record(seq, nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := seq.Set("bpm", 60.); err != nil {
+		t.Fatal(err)
+	}
+	samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+	var snd *Sound
+	for n := 0; n < 20*sampleRate/bufferSize && snd == nil; n++ {
+		sink.Process(samples)
+		select {
+		case snd = <-done:
+		default:
+		}
+	}
+	if snd == nil {
+		t.Fatal("recording didn't finish")
+	}
+	if !rec.Truncated() {
+		t.Errorf("recording of %v samples not truncated", snd.len())
+	}
+}
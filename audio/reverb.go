@@ -0,0 +1,151 @@
+package audio
+
+import (
+	"math"
+	"sync/atomic"
+)
+
+const (
+	propSize     = "size"
+	propDecay    = "decay"
+	propDamping  = "damping"
+	propPredelay = "predelay"
+	propWidth    = "width"
+
+	maxPredelay = 0.5 // seconds
+	// reverbInput scales the input, which is summed by eight combs
+	reverbInput  = 0.015
+	stereoSpread = 23 // samples that the right channel's delays are longer
+)
+
+// Delay lengths in samples of the combs and allpasses of Freeverb, at a size of
+// 0.5.
+var (
+	combLengths    = [...]int{1116, 1188, 1277, 1356, 1422, 1491, 1557, 1617}
+	allpassLengths = [...]int{556, 441, 341, 225}
+)
+
+// reverb is the Freeverb algorithm: parallel lowpass feedback combs followed by
+// allpasses in series, for each channel. Unlike the original, the decay is a time
+// in seconds, so it doesn't change with the size of the room.
+type reverb struct {
+	*Props
+	size     *atomic.Value
+	decay    *atomic.Value
+	damping  *atomic.Value
+	predelay *atomic.Value
+	width    *atomic.Value
+	mix      *atomic.Value
+
+	// state
+	combs     [2][len(combLengths)]comb
+	allpasses [2][len(allpassLengths)]allpass
+	pre       []float64 // predelay line of the mono input
+	prePos    int
+}
+
+func newReverb(props *Props, seq *Sequencer) Effect {
+	r := &reverb{
+		Props:    props,
+		size:     props.MustRegister(propSize, setFloat64(0, 1), 0.5),
+		decay:    props.MustRegister(propDecay, setFloat64(0.1, 30), 2.),
+		damping:  props.MustRegister(propDamping, setFloat64(0, 1), 0.5),
+		predelay: props.MustRegister(propPredelay, setFloat64(0, maxPredelay), 0.01),
+		width:    props.MustRegister(propWidth, setFloat64(0, 1), 1.),
+		mix:      props.MustRegister(propMix, setFloat64(0, 1), 0.3),
+		pre:      make([]float64, int(maxPredelay*sampleRate)+1),
+	}
+	for c := range r.combs {
+		// Room for the largest size
+		for i, length := range combLengths {
+			r.combs[c][i].buf = make([]float64, int(roomScale(1)*float64(length+c*stereoSpread))+1)
+		}
+		for i, length := range allpassLengths {
+			r.allpasses[c][i].buf = make([]float64, length+c*stereoSpread)
+		}
+	}
+	return r
+}
+
+// roomScale returns the factor for the comb lengths at size.
+func roomScale(size float64) float64 {
+	return 0.5 + size
+}
+
+func (r *reverb) Process(samples [][]float32) {
+	scale := roomScale(r.size.Load().(float64))
+	decay := r.decay.Load().(float64)
+	damping := r.damping.Load().(float64)
+	width := r.width.Load().(float64)
+	mix := r.mix.Load().(float64)
+	predelay := int(r.predelay.Load().(float64) * sampleRate)
+	for c := range r.combs {
+		for i := range r.combs[c] {
+			comb := &r.combs[c][i]
+			comb.length = int(scale * float64(combLengths[i]+c*stereoSpread))
+			// Feedback that decays by 60 dB in decay seconds
+			comb.feedback = math.Pow(10, -3*float64(comb.length)/(decay*sampleRate))
+			comb.damping = damping
+		}
+	}
+	wet1, wet2 := 0.5+width/2, (1-width)/2
+
+	for n := range samples[0] {
+		inL, inR := float64(samples[0][n]), float64(samples[1][n])
+		r.pre[r.prePos] = (inL + inR) * reverbInput
+		read := r.prePos - predelay
+		if read < 0 {
+			read += len(r.pre)
+		}
+		in := r.pre[read]
+		r.prePos = (r.prePos + 1) % len(r.pre)
+
+		var out [2]float64
+		for c := range out {
+			for i := range r.combs[c] {
+				out[c] += r.combs[c][i].process(in)
+			}
+			for i := range r.allpasses[c] {
+				out[c] = r.allpasses[c][i].process(out[c])
+			}
+		}
+		wetL := out[0]*wet1 + out[1]*wet2
+		wetR := out[1]*wet1 + out[0]*wet2
+		samples[0][n] = float32(inL + mix*(wetL-inL))
+		samples[1][n] = float32(inR + mix*(wetR-inR))
+	}
+}
+
+// comb is a feedback comb filter with a lowpass filter in the feedback path.
+type comb struct {
+	buf      []float64
+	pos      int
+	length   int
+	feedback float64
+	damping  float64
+	store    float64 // state of the lowpass filter
+}
+
+func (c *comb) process(in float64) float64 {
+	if c.pos >= c.length {
+		c.pos = 0
+	}
+	out := c.buf[c.pos]
+	c.store = out*(1-c.damping) + c.store*c.damping
+	c.buf[c.pos] = in + c.store*c.feedback
+	c.pos++
+	return out
+}
+
+// allpass is the allpass of Freeverb, which is only an approximation of one.
+type allpass struct {
+	buf []float64
+	pos int
+}
+
+func (a *allpass) process(in float64) float64 {
+	bufout := a.buf[a.pos]
+	a.buf[a.pos] = in + bufout*0.5
+	a.pos = (a.pos + 1) % len(a.buf)
+	return bufout - in
+}
@@ -0,0 +1,77 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+// impulseResponse returns the left and right output of effect for an impulse.
+func impulseResponse(effect Effect, length int) [2][]float64 {
+	return response(effect, length, func(n int) float64 {
+		if n == 0 {
+			return 1
+		}
+		return 0
+	})
+}
+
+// response returns the left and right output of effect for length samples of
+// signal on both channels.
+func response(effect Effect, length int, signal func(n int) float64) [2][]float64 {
+	samples := [][]float32{make([]float32, bufferSize), make([]float32, bufferSize)}
+	var out [2][]float64
+	for pos := 0; pos < length; pos += bufferSize {
+		for n := range samples[0] {
+			v := float32(signal(pos + n))
+			samples[0][n], samples[1][n] = v, v
+		}
+		effect.Process(samples)
+		for i := range samples {
+			for _, v := range samples[i] {
+				out[i] = append(out[i], float64(v))
+			}
+		}
+	}
+	return out
+}
+
+// rms returns the level in dB of buf between two times in seconds.
+func rms(buf []float64, from, to float64) float64 {
+	var sum float64
+	window := buf[int(from*sampleRate):int(to*sampleRate)]
+	for _, v := range window {
+		sum += v * v
+	}
+	return 10 * math.Log10(sum/float64(len(window)))
+}
+
+func TestReverb(t *testing.T) {
+	effect, _ := NewEffect("reverb", NewProps(), nil)
+	effect.Set(propMix, 1.)
+	effect.Set(propPredelay, 0.1)
+	effect.Set(propDecay, 1.)
+	effect.Set(propDamping, 0.)
+	out := impulseResponse(effect, 2*sampleRate)
+
+	first := -1
+	for n, v := range out[0] {
+		if v != 0 {
+			first = n
+			break
+		}
+	}
+	if want := int(0.1*sampleRate) + combLengths[0]; first != want {
+		t.Errorf("wrong start of the reverb: want %v, got %v", want, first)
+	}
+	if decay := rms(out[0], 0.2, 0.3) - rms(out[0], 1.2, 1.3); decay < 50 || decay > 70 {
+		t.Errorf("wrong decay after 1 second: want about 60 dB, got %.1f dB", decay)
+	}
+
+	effect.Set(propWidth, 0.)
+	out = impulseResponse(effect, sampleRate/2)
+	for n := range out[0] {
+		if out[0][n] != out[1][n] {
+			t.Fatalf("sample %d: want mono output at width 0, got %v and %v", n, out[0][n], out[1][n])
+		}
+	}
+}
@@ -1,39 +1,58 @@
 package audio
 
 import (
+	"encoding/binary"
 	"fmt"
 	"io"
 	"log"
 	"math"
-	"os"
 	"strconv"
+	"strings"
 	"sync/atomic"
+)
 
-	"github.com/youpy/go-wav"
+const (
+	PropSoundMap = "sounds.map"
+	propInterp   = "interp"
 )
 
-const PropSoundMap = "sounds.map"
 const numKeys = 127
 
-func Sampler(props *Props) *Instrument {
+// Sampler creates an instrument that plays sounds mapped to keys. The sequencer
+// sets the tempo for sounds that are synced to it.
+func Sampler(props *Props, seq *Sequencer) *Instrument {
 	sounds := props.MustRegister(PropSoundMap, setSoundMapping, &SoundMapping{})
+	interp := props.MustRegister(propInterp, setInterpolation, "cubic")
 	var perKeyProps [numKeys]keyProps
 	for n := 0; n < numKeys; n++ {
 		note := strconv.Itoa(n)
 		var kp keyProps
 		kp.envAttack = props.MustRegister("env.attack."+note, setEnvParam, 0.0005)
 		kp.envDecay = props.MustRegister("env.decay."+note, setEnvParam, 5.0)
+		kp.envSustain = props.MustRegister("env.sustain."+note, setFloat64(0, 1), 0.)
+		kp.envRelease = props.MustRegister("env.release."+note, setEnvParam, 0.2)
 		kp.level = props.MustRegister("level."+note, setLevel, 0.)
 		kp.choke = props.MustRegister("choke."+note, setInt, 0)
+		kp.tune = props.MustRegister("tune."+note, setFloat64(-48, 48), 0.)
+		kp.reverse = props.MustRegister("reverse."+note, setBool, false)
+		kp.pan = props.MustRegister("pan."+note, setFloat64(-1, 1), 0.)
+		kp.loop = props.MustRegister("loop."+note, setLoopMode, "auto")
+		kp.loopStart = props.MustRegister("loop.start."+note, setIntRange(-1, math.MaxInt32), -1)
+		kp.loopEnd = props.MustRegister("loop.end."+note, setIntRange(-1, math.MaxInt32), -1)
+		kp.syncBeats = props.MustRegister("sync.beats."+note, setFloat64(0, 1024), 0.)
 		perKeyProps[n] = kp
 	}
 	voices := make([]Voice, numVoices)
+	var roundRobin [numKeys]int
 	for n := range voices {
 		voices[n] = &samplerVoice{
-			state:    stateFree,
-			sounds:   sounds,
-			keyProps: perKeyProps,
-			env:      &envelope{},
+			state:      stateFree,
+			sounds:     sounds,
+			roundRobin: &roundRobin,
+			seq:        seq,
+			interp:     interp,
+			keyProps:   perKeyProps,
+			env:        &envelope{},
 		}
 	}
 	inst := NewInstrument(props, voices)
@@ -41,29 +60,70 @@ func Sampler(props *Props) *Instrument {
 }
 
 type samplerVoice struct {
-	sounds   *atomic.Value
-	keyProps [numKeys]keyProps
-	state    voiceState
-	env      *envelope
-	buf      []float64
-	pos      int
-	pitch    int
+	sounds *atomic.Value
+	// roundRobin counts the notes played per key. It's shared by all voices of a
+	// sampler and only used from the audio thread.
+	roundRobin *[numKeys]int
+	interp     *atomic.Value
+	keyProps   [numKeys]keyProps
+	seq        *Sequencer
+	state      voiceState
+	env        *envelope
+	bufs       [2][]float64
+	pos        float64 // position in bufs, in samples
+	rate       float64 // playback speed, negative when playing in reverse
+	pitch      int
+
+	loop          loopMode
+	loopStart     float64
+	loopEnd       float64 // exclusive
+	duration      int
+	samplesPlayed int
+
+	// Sounds that are synced to the tempo are played with overlapping grains.
+	// pos and rate are then the position and speed of the grains in the sound,
+	// and the grains themselves play at grainRate.
+	syncBeats  float64
+	grainRate  float64
+	grains     [2]grain
+	sinceGrain int
 }
 
 func (v *samplerVoice) PlayNote(pitch, velocity, duration int) {
 	mapping := v.sounds.Load().(*SoundMapping)
-	snd := mapping[pitch]
-	if snd == nil {
-		log.Printf("sampler: no sound mapped to pitch %d", pitch)
+	layer := mapping.choose(pitch, velocity, v.roundRobin[pitch])
+	if layer == nil {
+		log.Printf("sampler: no sound mapped to pitch %d, velocity %d", pitch, velocity)
 		return
 	}
+	snd := layer.sound
+	v.roundRobin[pitch]++
 	props := v.keyProps[pitch]
-	v.buf = snd.buf
+	v.bufs = snd.bufs
 	v.state = stateActive
 	v.env.attack = props.envAttack.Load().(float64)
 	v.env.decay = props.envDecay.Load().(float64)
+	v.env.sustain = props.envSustain.Load().(float64)
+	v.env.release = props.envRelease.Load().(float64)
 	v.env.startAttack()
 	v.pitch = pitch
+	v.duration = duration
+	v.samplesPlayed = 0
+	v.loop, v.loopStart, v.loopEnd = props.loopPoints(snd)
+
+	semitones := float64(pitch-layer.root) + props.tune.Load().(float64)
+	v.rate = math.Pow(2, semitones/12) * snd.sampleRate / sampleRate
+	v.pos = 0
+	if props.reverse.Load().(bool) {
+		v.rate = -v.rate
+		v.pos = float64(snd.len() - 1)
+	}
+
+	v.syncBeats = props.syncBeats.Load().(float64)
+	if v.syncBeats > 0 {
+		v.grainRate = math.Abs(v.rate)
+		v.startGrains()
+	}
 }
 
 func (v *samplerVoice) Notify(pitch int) {
@@ -76,49 +136,304 @@ func (v *samplerVoice) Notify(pitch int) {
 	}
 }
 
-func (v *samplerVoice) Process(buf []float64) {
-	level := v.keyProps[v.pitch].level.Load().(float64)
-	gain := math.Pow(10, level/20.0)
+func (v *samplerVoice) Process(left, right []float64) {
+	props := v.keyProps[v.pitch]
+	gain := math.Pow(10, props.level.Load().(float64)/20.0)
+	gl, gr := panGains(props.pan.Load().(float64))
+	gl, gr = gl*gain, gr*gain
+	interp := v.interp.Load().(interpolation)
+	if bpm := v.seq.tempo(); v.syncBeats > 0 && bpm > 0 {
+		// The sound lasts syncBeats at the current tempo. Without a tempo the
+		// voice keeps its last rate, so it still plays to the end.
+		length := float64(len(v.bufs[0]))
+		v.rate = math.Copysign(length*bpm/(v.syncBeats*60*sampleRate), v.rate)
+	}
 
-	n := len(buf)
-	if nsamples := len(v.buf) - v.pos; nsamples < n {
-		n = nsamples
+	for i := range left {
+		if v.pos < 0 || v.pos >= float64(len(v.bufs[0])) {
+			v.free()
+			return
+		}
+		var l, r float64
+		if v.syncBeats > 0 {
+			l, r = v.nextGrainSample(interp)
+		} else {
+			l = interpolate(v.bufs[0], v.pos, v.rate, interp)
+			r = interpolate(v.bufs[1], v.pos, v.rate, interp)
+		}
+		env := v.env.value()
+		left[i] += l * env * gl
+		right[i] += r * env * gr
+		v.pos += v.rate
+		if v.loop != loopOff {
+			v.wrap()
+		}
+	}
+	v.samplesPlayed += len(left)
+	// Looped sounds sustain while the note is held. After that the loop is left
+	// and the sound plays out during the release.
+	if v.state == stateActive && v.loop != loopOff && v.samplesPlayed >= v.duration {
+		v.loop = loopOff
+		v.release()
 	}
-	for i := range buf[:n] {
-		buf[i] += v.buf[v.pos] * v.env.value() * gain
-		v.pos++
+	if v.state == stateReleased && v.env.state == stateInit {
+		v.free()
 	}
-	if v.pos >= len(v.buf) {
-		v.buf = nil
-		v.pos = 0
-		v.state = stateFree
-		v.pitch = 0
+}
+
+// wrap moves the play position back into the loop when it has passed one of the
+// loop points.
+func (v *samplerVoice) wrap() {
+	length := v.loopEnd - v.loopStart
+	switch {
+	case v.rate > 0 && v.pos >= v.loopEnd:
+		if v.loop == loopPingPong {
+			v.pos = 2*(v.loopEnd-1) - v.pos
+			v.rate = -v.rate
+		} else {
+			v.pos = v.loopStart + math.Mod(v.pos-v.loopStart, length)
+		}
+	case v.rate < 0 && v.pos < v.loopStart:
+		if v.loop == loopPingPong {
+			v.pos = 2*v.loopStart - v.pos
+			v.rate = -v.rate
+		} else {
+			v.pos = v.loopEnd - math.Mod(v.loopStart-v.pos, length)
+		}
 	}
 }
 
+func (v *samplerVoice) release() {
+	v.state = stateReleased
+	v.env.startRelease()
+}
+
 func (v *samplerVoice) stop() {
-	v.env.decayRate = 1.0 / (0.001 / sampleRate)
+	v.env.release = 0.001
+	v.release()
+}
+
+func (v *samplerVoice) free() {
+	v.bufs = [2][]float64{}
+	v.pos = 0
+	v.state = stateFree
+	v.pitch = 0
 }
 
 func (v *samplerVoice) State() voiceState { return v.state }
 
 // keyProps stores the properties for a single key.
 type keyProps struct {
-	envAttack *atomic.Value
-	envDecay  *atomic.Value
-	level     *atomic.Value
-	choke     *atomic.Value
+	envAttack  *atomic.Value
+	envDecay   *atomic.Value
+	envSustain *atomic.Value
+	envRelease *atomic.Value
+	level      *atomic.Value
+	choke      *atomic.Value
+	tune       *atomic.Value
+	reverse    *atomic.Value
+	pan        *atomic.Value
+	loop       *atomic.Value
+	loopStart  *atomic.Value
+	loopEnd    *atomic.Value
+	syncBeats  *atomic.Value
+}
+
+// loopPoints returns the loop of a key. The loop mode, start and end default to
+// the loop stored in the sound file. An invalid loop turns looping off.
+func (kp *keyProps) loopPoints(snd *Sound) (mode loopMode, start, end float64) {
+	mode = kp.loop.Load().(loopMode)
+	if mode == loopAuto {
+		mode = snd.loop
+	}
+	s, e := kp.loopStart.Load().(int), kp.loopEnd.Load().(int)
+	if s < 0 {
+		s = snd.loopStart
+	}
+	if e < 0 {
+		e = snd.loopEnd
+	}
+	if e == 0 || e > snd.len() {
+		e = snd.len()
+	}
+	if s >= e {
+		return loopOff, 0, 0
+	}
+	return mode, float64(s), float64(e)
+}
+
+type loopMode int
+
+const (
+	loopAuto loopMode = iota
+	loopOff
+	loopForward
+	loopPingPong
+)
+
+var loopModes = map[string]loopMode{
+	"auto":     loopAuto,
+	"off":      loopOff,
+	"forward":  loopForward,
+	"pingpong": loopPingPong,
 }
 
 type Sound struct {
-	buf  []float64
+	bufs [2][]float64 // left and right, which share the same buffer for mono files
 	file string
+
+	loop      loopMode // loopOff when the file has no loop
+	loopStart int
+	loopEnd   int // exclusive
+
+	sampleRate float64
+	slice      *sliceInfo // nil unless the sound is a slice of a file
 }
 
-type SoundMapping [numKeys]*Sound
+// len returns the length of the sound in samples.
+func (s *Sound) len() int {
+	return len(s.bufs[0])
+}
 
-func (m *SoundMapping) Put(key int, snd *Sound) {
-	m[key] = snd
+// A Layer is a sound that plays for a range of velocities. Layers of a key with
+// overlapping velocity ranges are played in turns (round-robin).
+type Layer struct {
+	sound   *Sound
+	velLow  int
+	velHigh int
+	root    int // the key at which the sound plays at its original pitch
+}
+
+// SoundMapping holds the layers of each key. It is replaced as a whole when
+// it changes, so the layer slices must not be modified in place.
+type SoundMapping [numKeys][]Layer
+
+// CheckKey returns an error if key is not a key of a sampler.
+func CheckKey(key int) error {
+	if key < 0 || key >= numKeys {
+		return fmt.Errorf("invalid key: %d", key)
+	}
+	return nil
+}
+
+// Put maps snd to a single key, where it plays at its original pitch. It replaces
+// the sounds that were mapped to the key.
+func (m *SoundMapping) Put(key int, snd *Sound) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	m[key] = []Layer{{sound: snd, velLow: 0, velHigh: maxVelocity, root: key}}
+	return nil
+}
+
+// PutSlices maps slices to consecutive keys, starting at key.
+func (m *SoundMapping) PutSlices(key int, slices []*Sound) error {
+	if key < 0 || key+len(slices) > numKeys {
+		return fmt.Errorf("%d slices don't fit from key %d", len(slices), key)
+	}
+	for n, snd := range slices {
+		m.Put(key+n, snd)
+	}
+	return nil
+}
+
+// AddLayer adds snd to the layers of key, for velocities from low up to and
+// including high.
+func (m *SoundMapping) AddLayer(key, low, high int, snd *Sound) error {
+	if err := CheckKey(key); err != nil {
+		return err
+	}
+	if low < 0 || high > maxVelocity || low > high {
+		return fmt.Errorf("invalid velocity range: %d - %d", low, high)
+	}
+	layers := m[key]
+	m[key] = append(layers[:len(layers):len(layers)], Layer{sound: snd, velLow: low, velHigh: high, root: key})
+	return nil
+}
+
+// choose returns the layer to play for a key and velocity. When multiple layers
+// match, n selects one of them.
+func (m *SoundMapping) choose(key, velocity, n int) *Layer {
+	var matches int
+	for _, l := range m[key] {
+		if velocity >= l.velLow && velocity <= l.velHigh {
+			matches++
+		}
+	}
+	if matches == 0 {
+		return nil
+	}
+	n %= matches
+	for i, l := range m[key] {
+		if velocity >= l.velLow && velocity <= l.velHigh {
+			if n == 0 {
+				return &m[key][i]
+			}
+			n--
+		}
+	}
+	return nil
+}
+
+// PutZone maps snd to the keys from low up to and including high. The sound is
+// transposed relative to the root key.
+func (m *SoundMapping) PutZone(root, low, high int, snd *Sound) error {
+	if low < 0 || high >= numKeys || low > high {
+		return fmt.Errorf("invalid key range: %d - %d", low, high)
+	}
+	for key := low; key <= high; key++ {
+		m[key] = []Layer{{sound: snd, velLow: 0, velHigh: maxVelocity, root: root}}
+	}
+	return nil
+}
+
+// String lists the sounds of each key. Consecutive keys with the same layers, like
+// the keys of a zone, are listed together.
+func (m *SoundMapping) String() string {
+	var b strings.Builder
+	for low := 0; low < numKeys; {
+		high := low
+		for high+1 < numKeys && sameLayers(m[low], m[high+1]) {
+			high++
+		}
+		if len(m[low]) > 0 {
+			keys := strconv.Itoa(low)
+			if high > low {
+				keys += "-" + strconv.Itoa(high)
+			}
+			fmt.Fprintf(&b, "%-8s", keys)
+			for n, l := range m[low] {
+				if n > 0 {
+					b.WriteString(", ")
+				}
+				b.WriteString(l.sound.file)
+				if sl := l.sound.slice; sl != nil {
+					fmt.Fprintf(&b, " [%d-%d]", sl.start, sl.end)
+				}
+				if l.velLow > 0 || l.velHigh < maxVelocity {
+					fmt.Fprintf(&b, " (velocity %d-%d)", l.velLow, l.velHigh)
+				}
+			}
+			if high > low {
+				fmt.Fprintf(&b, " (root %d)", m[low][0].root)
+			}
+			b.WriteString("\n")
+		}
+		low = high + 1
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
+
+func sameLayers(a, b []Layer) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for n := range a {
+		if a[n] != b[n] {
+			return false
+		}
+	}
+	return true
 }
 
 func setSoundMapping(v interface{}, dest *atomic.Value) error {
@@ -130,26 +445,60 @@ func setSoundMapping(v interface{}, dest *atomic.Value) error {
 	}
 }
 
-func LoadSound(file string) (*Sound, error) {
-	f, err := os.Open(file)
-	if err != nil {
-		return nil, err
+func setLoopMode(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	mode, ok := loopModes[s]
+	if !ok {
+		return fmt.Errorf("not a valid loop mode: %v", s)
 	}
-	defer f.Close()
+	dest.Store(mode)
+	return nil
+}
 
-	snd := Sound{file: file}
-	r := wav.NewReader(f)
-	for {
-		samples, err := r.ReadSamples()
-		if err == io.EOF {
-			break
-		}
-		if err != nil {
-			return nil, err
-		}
-		for _, sample := range samples {
-			snd.buf = append(snd.buf, r.FloatValue(sample, 0))
-		}
+// smplLoop is a loop in a smpl chunk. Start and end are sample offsets, and end is
+// inclusive.
+type smplLoop struct {
+	CuePointID uint32
+	Type       uint32 // 0 is forward, 1 is ping-pong, 2 is backward
+	Start      uint32
+	End        uint32
+	Fraction   uint32
+	PlayCount  uint32
+}
+
+func parseSmplChunk(r io.Reader, snd *Sound) error {
+	var header struct {
+		Manufacturer      uint32
+		Product           uint32
+		SamplePeriod      uint32
+		MIDIUnityNote     uint32
+		MIDIPitchFraction uint32
+		SMPTEFormat       uint32
+		SMPTEOffset       uint32
+		NumSampleLoops    uint32
+		SamplerData       uint32
+	}
+	if err := binary.Read(r, binary.LittleEndian, &header); err != nil {
+		return fmt.Errorf("invalid smpl chunk: %v", err)
+	}
+	if header.NumSampleLoops == 0 {
+		return nil
+	}
+	var loop smplLoop
+	if err := binary.Read(r, binary.LittleEndian, &loop); err != nil {
+		return fmt.Errorf("invalid smpl chunk: %v", err)
+	}
+	if loop.End < loop.Start || int(loop.End) >= snd.len() {
+		return nil
+	}
+	snd.loop = loopForward
+	if loop.Type == 1 {
+		snd.loop = loopPingPong
 	}
-	return &snd, nil
+	snd.loopStart = int(loop.Start)
+	snd.loopEnd = int(loop.End) + 1
+	return nil
 }
@@ -0,0 +1,265 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"testing"
+)
+
+func TestSamplerLoop(t *testing.T) {
+	for _, mode := range []string{"forward", "pingpong"} {
+		buf := make([]float64, 1000)
+		for n := range buf {
+			buf[n] = float64(n)
+		}
+		snd := &Sound{bufs: [2][]float64{buf, buf}, loop: loopOff, sampleRate: sampleRate}
+		mapping := &SoundMapping{}
+		mapping.Put(0, snd)
+
+		sampler := Sampler(NewProps(), NewSequencer(NewProps()))
+		for key, val := range map[string]interface{}{
+			PropSoundMap:    mapping,
+			"interp":        "linear",
+			"env.sustain.0": 1.,
+			"env.release.0": 0.01,
+			"loop.0":        mode,
+			"loop.start.0":  100,
+			"loop.end.0":    200,
+		} {
+			if err := sampler.Set(key, val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		voice := sampler.voices[0].(*samplerVoice)
+		voice.PlayNote(0, defaultVelocity, 5000)
+
+		voice.Process(make([]float64, 500), make([]float64, 500))
+		for n := 0; n < 4000; n++ {
+			voice.Process(make([]float64, 1), make([]float64, 1))
+			if pos := voice.pos; pos < 100 || pos >= 200 {
+				t.Fatalf("%s: play position outside of the loop: %v", mode, pos)
+			}
+		}
+		if voice.State() != stateActive {
+			t.Fatalf("%s: voice stopped while the note is held", mode)
+		}
+
+		// The release plays out the rest of the sound
+		for n := 0; n < 10 && voice.State() != stateFree; n++ {
+			voice.Process(make([]float64, bufferSize), make([]float64, bufferSize))
+		}
+		if voice.State() != stateFree {
+			t.Errorf("%s: voice not freed after the release", mode)
+		}
+	}
+}
+
+func TestParseSmplChunk(t *testing.T) {
+	var chunk bytes.Buffer
+	header := [9]uint32{7: 1} // a single loop
+	loop := smplLoop{Type: 1, Start: 10, End: 19}
+	binary.Write(&chunk, binary.LittleEndian, header)
+	binary.Write(&chunk, binary.LittleEndian, loop)
+
+	buf := make([]float64, 100)
+	snd := &Sound{bufs: [2][]float64{buf, buf}, loop: loopOff, sampleRate: sampleRate}
+	if err := parseSmplChunk(&chunk, snd); err != nil {
+		t.Fatal(err)
+	}
+	if snd.loop != loopPingPong {
+		t.Errorf("wrong loop mode: want %v, got %v", loopPingPong, snd.loop)
+	}
+	if snd.loopStart != 10 || snd.loopEnd != 20 {
+		t.Errorf("wrong loop points: want 10 - 20, got %v - %v", snd.loopStart, snd.loopEnd)
+	}
+}
+
+func TestSoundMappingLayers(t *testing.T) {
+	soft, hard1, hard2 := &Sound{file: "soft"}, &Sound{file: "hard1"}, &Sound{file: "hard2"}
+	m := &SoundMapping{}
+	for _, l := range []Layer{{sound: soft, velLow: 0, velHigh: 63}, {sound: hard1, velLow: 64, velHigh: 127}, {sound: hard2, velLow: 64, velHigh: 127}} {
+		if err := m.AddLayer(42, l.velLow, l.velHigh, l.sound); err != nil {
+			t.Fatal(err)
+		}
+	}
+	tests := []struct {
+		velocity, n int
+		want        *Sound
+	}{
+		{30, 0, soft},
+		{30, 1, soft},
+		{100, 0, hard1},
+		{100, 1, hard2},
+		{100, 2, hard1},
+	}
+	for _, test := range tests {
+		if got := m.choose(42, test.velocity, test.n).sound; got != test.want {
+			t.Errorf("velocity %d, note %d: want %v, got %v", test.velocity, test.n, test.want.file, got.file)
+		}
+	}
+	if err := m.AddLayer(42, 100, 50, soft); err == nil {
+		t.Error("expected an error for an invalid velocity range")
+	}
+}
+
+func TestSequencedVelocity(t *testing.T) {
+	soft, hard := make([]float64, 2*bufferSize), make([]float64, 2*bufferSize)
+	mapping := &SoundMapping{}
+	mapping.AddLayer(42, 0, 63, &Sound{bufs: [2][]float64{soft, soft}, loop: loopOff, sampleRate: sampleRate})
+	mapping.AddLayer(42, 64, 127, &Sound{bufs: [2][]float64{hard, hard}, loop: loopOff, sampleRate: sampleRate})
+
+	for _, test := range []struct {
+		velocity int
+		want     []float64
+	}{{40, soft}, {100, hard}} {
+		seq := NewSequencer(NewProps())
+		sampler := Sampler(NewProps(), seq)
+		sampler.Set(PropSoundMap, mapping)
+		clip := NewClip(1, sampler)
+		clip.AddNoteVelocity(0, 42, test.velocity, 1)
+		seq.Set("clips", map[string]*Clip{"hats": clip})
+
+		seq.Tick(bufferSize)
+		sampler.Process([][]float32{make([]float32, bufferSize), make([]float32, bufferSize)})
+		voice := sampler.voices[0].(*samplerVoice)
+		if voice.state != stateActive || &voice.bufs[0][0] != &test.want[0] {
+			t.Errorf("velocity %d: the layer for the velocity didn't play", test.velocity)
+		}
+	}
+}
+
+func TestSoundMappingRoots(t *testing.T) {
+	snd := &Sound{file: "piano"}
+	m := &SoundMapping{}
+	m.Put(60, snd)
+	m.PutZone(48, 36, 59, snd)
+	m.AddLayer(72, 0, 127, snd)
+	for key, want := range map[int]int{60: 60, 40: 48, 72: 72} {
+		if got := m.choose(key, defaultVelocity, 0).root; got != want {
+			t.Errorf("key %d: wrong root: want %v, got %v", key, want, got)
+		}
+	}
+}
+
+func TestSamplerStereo(t *testing.T) {
+	l, r := make([]float64, 100), make([]float64, 100)
+	for n := range l {
+		l[n], r[n] = 1, 0.5
+	}
+	mapping := &SoundMapping{}
+	mapping.Put(0, &Sound{bufs: [2][]float64{l, r}, loop: loopOff, sampleRate: sampleRate})
+
+	tests := []struct {
+		pan         float64
+		left, right float64
+	}{
+		{0, 1, 0.5},
+		{-1, 1, 0},
+		{1, 0, 0.5},
+		{0.5, 1 / (1 + math.Sqrt2), 0.5},
+	}
+	for _, test := range tests {
+		sampler := Sampler(NewProps(), NewSequencer(NewProps()))
+		if err := sampler.Set(PropSoundMap, mapping); err != nil {
+			t.Fatal(err)
+		}
+		if err := sampler.Set("pan.0", test.pan); err != nil {
+			t.Fatal(err)
+		}
+		voice := sampler.voices[0].(*samplerVoice)
+		voice.PlayNote(0, defaultVelocity, 100)
+		voice.env.state = stateSustain // skip the envelope
+		voice.env.sustain = 1
+		left, right := make([]float64, 10), make([]float64, 10)
+		voice.Process(left, right)
+		if math.Abs(left[5]-test.left) > 1e-9 || math.Abs(right[5]-test.right) > 1e-9 {
+			t.Errorf("pan %v: want %v/%v, got %v/%v", test.pan, test.left, test.right, left[5], right[5])
+		}
+	}
+}
+
+func TestSamplerSync(t *testing.T) {
+	// One second of a 441 Hz sine, declared as 4 beats long
+	buf := make([]float64, sampleRate)
+	for n := range buf {
+		buf[n] = math.Sin(twoPi * 441 * float64(n) / sampleRate)
+	}
+	mapping := &SoundMapping{}
+	mapping.Put(0, &Sound{bufs: [2][]float64{buf, buf}, loop: loopOff, sampleRate: sampleRate})
+
+	for _, bpm := range []float64{120, 240, 60} {
+		seq := NewSequencer(NewProps())
+		sampler := Sampler(NewProps(), seq)
+		for key, val := range map[string]interface{}{
+			PropSoundMap:    mapping,
+			"sync.beats.0":  4.,
+			"env.sustain.0": 1.,
+		} {
+			if err := sampler.Set(key, val); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := seq.Set("bpm", bpm); err != nil {
+			t.Fatal(err)
+		}
+		voice := sampler.voices[0].(*samplerVoice)
+		voice.PlayNote(0, defaultVelocity, 10*sampleRate)
+
+		var out []float64
+		for voice.State() != stateFree && len(out) < 10*sampleRate {
+			left, right := make([]float64, blockSize), make([]float64, blockSize)
+			voice.Process(left, right)
+			out = append(out, left...)
+		}
+		want := 4 * 60 / bpm * sampleRate
+		if math.Abs(float64(len(out))-want) > blockSize {
+			t.Errorf("%v bpm: wrong length: want %v, got %v", bpm, want, len(out))
+		}
+
+		// The pitch doesn't change
+		var crossings int
+		mid := out[len(out)/4 : len(out)/4+sampleRate/4]
+		for n := 1; n < len(mid); n++ {
+			if mid[n-1] < 0 && mid[n] >= 0 {
+				crossings++
+			}
+		}
+		if crossings < 108 || crossings > 112 {
+			t.Errorf("%v bpm: wrong pitch: want 110 cycles, got %v", bpm, crossings)
+		}
+	}
+}
+
+func TestSamplerSyncWithoutTempo(t *testing.T) {
+	buf := make([]float64, sampleRate/10)
+	mapping := &SoundMapping{}
+	mapping.Put(0, &Sound{bufs: [2][]float64{buf, buf}, loop: loopOff, sampleRate: sampleRate})
+
+	seq := NewSequencer(NewProps())
+	sampler := Sampler(NewProps(), seq)
+	for key, val := range map[string]interface{}{
+		PropSoundMap:   mapping,
+		"sync.beats.0": 4.,
+		"reverse.0":    true,
+	} {
+		if err := sampler.Set(key, val); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := seq.Set("bpm", 0.); err != nil {
+		t.Fatal(err)
+	}
+	voice := sampler.voices[0].(*samplerVoice)
+	voice.PlayNote(0, defaultVelocity, sampleRate)
+	left, right := make([]float64, blockSize), make([]float64, blockSize)
+	for n := 0; n < sampleRate/blockSize && voice.State() != stateFree; n++ {
+		voice.Process(left, right)
+		if voice.rate >= 0 {
+			t.Fatalf("reversed voice has rate %v", voice.rate)
+		}
+	}
+	if voice.State() != stateFree {
+		t.Errorf("voice not freed at 0 bpm")
+	}
+}
@@ -9,6 +9,12 @@ import (
 // Pulses per quarter note
 const PPQN = 960.
 
+// Note velocities. Notes added to a clip have the default velocity.
+const (
+	defaultVelocity = 100
+	maxVelocity     = 127
+)
+
 type Clip struct {
 	Length     int
 	instrument Playable
@@ -27,13 +33,19 @@ type Playable interface {
 }
 
 func (c *Clip) AddNote(position float64, pitch int, length float64) {
-	if pitch < 0 || pitch > 127 {
+	c.AddNoteVelocity(position, pitch, defaultVelocity, length)
+}
+
+// AddNoteVelocity adds a note with a velocity from 1 to 127.
+func (c *Clip) AddNoteVelocity(position float64, pitch, velocity int, length float64) {
+	if pitch < 0 || pitch > 127 || velocity < 1 || velocity > maxVelocity {
 		return
 	}
 	c.notes = append(c.notes, note{
-		pos:    int(position * PPQN),
-		pitch:  pitch,
-		length: length,
+		pos:      int(position * PPQN),
+		pitch:    pitch,
+		velocity: velocity,
+		length:   length,
 	})
 }
 
@@ -50,6 +62,7 @@ type Sequencer struct {
 	clips       *atomic.Value
 	sampleRate  float64
 	totalPulses uint64
+	lastPulses  uint64 // totalPulses before the last tick
 }
 
 func NewSequencer(props *Props) *Sequencer {
@@ -94,9 +107,27 @@ func (s *Sequencer) Tick(numSamples int) {
 			}
 		}
 	}
+	s.lastPulses = s.totalPulses
 	s.totalPulses += uint64(numPulses)
 }
 
+// position returns the number of beats played since the sequencer started. It should
+// only be called from the audio thread.
+func (s *Sequencer) position() float64 {
+	return float64(s.totalPulses) / PPQN
+}
+
+// lastTick returns the beats covered by the last tick. It should only be called from
+// the audio thread.
+func (s *Sequencer) lastTick() (from, to float64) {
+	return float64(s.lastPulses) / PPQN, float64(s.totalPulses) / PPQN
+}
+
+// tempo returns the current tempo in beats per minute.
+func (s *Sequencer) tempo() float64 {
+	return s.bpm.Load().(float64)
+}
+
 func setClips(v interface{}, dest *atomic.Value) error {
 	if c, ok := v.(map[string]*Clip); ok {
 		dest.Store(c)
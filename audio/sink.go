@@ -1,6 +1,10 @@
 package audio
 
 import (
+	"fmt"
+	"sync"
+	"sync/atomic"
+
 	"github.com/gordonklaus/portaudio"
 )
 
@@ -16,23 +20,47 @@ func NewSink() (*Sink, error) {
 	if err := portaudio.Initialize(); err != nil {
 		return nil, err
 	}
-	var s Sink
+	s := newSink()
 	stream, err := portaudio.OpenDefaultStream(0, 2, sampleRate, bufferSize, s.Process)
 	if err != nil {
 		return nil, err
 	}
 	s.stream = stream
-	return &s, nil
+	return s, nil
+}
+
+func newSink() *Sink {
+	s := &Sink{
+		channels:   &atomic.Value{},
+		buses:      &atomic.Value{},
+		tickers:    &atomic.Value{},
+		recordings: &atomic.Value{},
+		master:     newMaster(),
+	}
+	s.channels.Store([]*Channel(nil))
+	s.buses.Store([]*Bus(nil))
+	s.tickers.Store([]Ticker(nil))
+	s.recordings.Store([]*Recording(nil))
+	return s
 }
 
 func (s *Sink) Start() error {
 	return s.stream.Start()
 }
 
+// Sink mixes its sources into the audio output. Every source plays through its own
+// channel of the mixer and then through the master. Channels can send to buses,
+// whose returns are mixed into the master as well. Sources, buses and tickers can
+// be added while the stream is running, but only from a single goroutine.
+// Recordings can be started and stopped from any goroutine.
 type Sink struct {
-	sources []Source
-	tickers []Ticker
-	stream  *portaudio.Stream
+	channels   *atomic.Value // []*Channel
+	buses      *atomic.Value // []*Bus
+	tickers    *atomic.Value // []Ticker
+	recordings *atomic.Value // []*Recording
+	mu         sync.Mutex    // serializes updates of recordings
+	master     *Master
+	stream     *portaudio.Stream
 }
 
 func (s *Sink) Stop() error {
@@ -41,12 +69,61 @@ func (s *Sink) Stop() error {
 	return nil
 }
 
+// AddSources adds a mixer channel for each source.
 func (s *Sink) AddSources(sources ...Source) {
-	s.sources = append(s.sources, sources...)
+	old := s.channels.Load().([]*Channel)
+	channels := old[:len(old):len(old)]
+	for _, source := range sources {
+		channels = append(channels, newChannel(source))
+	}
+	s.channels.Store(channels)
+}
+
+// Channel returns the mixer channel of source, or nil if it's not a source of the
+// sink.
+func (s *Sink) Channel(source Source) *Channel {
+	for _, c := range s.channels.Load().([]*Channel) {
+		if c.source == source {
+			return c
+		}
+	}
+	return nil
+}
+
+// AddBus adds a new bus to the sink.
+func (s *Sink) AddBus() *Bus {
+	bus := newBus()
+	old := s.buses.Load().([]*Bus)
+	s.buses.Store(append(old[:len(old):len(old)], bus))
+	return bus
+}
+
+// Sidechain keys a compressor by the output of source, before its inserts. A nil
+// source removes the sidechain.
+func (s *Sink) Sidechain(effect Effect, source Source) error {
+	comp, ok := effect.(*compressor)
+	if !ok {
+		return fmt.Errorf("effect has no sidechain input")
+	}
+	if source == nil {
+		comp.key.Store((*Channel)(nil))
+		return nil
+	}
+	channel := s.Channel(source)
+	if channel == nil {
+		return fmt.Errorf("source is not connected to the mixer")
+	}
+	comp.key.Store(channel)
+	return nil
+}
+
+func (s *Sink) Master() *Master {
+	return s.master
 }
 
 func (s *Sink) AddTicker(ticker Ticker) {
-	s.tickers = append(s.tickers, ticker)
+	old := s.tickers.Load().([]Ticker)
+	s.tickers.Store(append(old[:len(old):len(old)], ticker))
 }
 
 func (s *Sink) Process(samples [][]float32) {
@@ -55,10 +132,41 @@ func (s *Sink) Process(samples [][]float32) {
 			samples[i][j] = 0.
 		}
 	}
-	for _, ticker := range s.tickers {
+	for _, ticker := range s.tickers.Load().([]Ticker) {
 		ticker.Tick(len(samples[0]))
 	}
-	for _, source := range s.sources {
-		source.Process(samples)
+	recordings := s.recordings.Load().([]*Recording)
+	channels := s.channels.Load().([]*Channel)
+	buses := s.buses.Load().([]*Bus)
+	for _, bus := range buses {
+		bus.reset(len(samples[0]))
+	}
+	var solo bool
+	for _, c := range channels {
+		solo = solo || c.solo.Load().(bool)
+	}
+	for _, c := range channels {
+		c.render(len(samples[0]))
+	}
+	for _, c := range channels {
+		c.process()
+		for _, r := range recordings {
+			if r.source == c.source {
+				r.process(c.bufs)
+			}
+		}
+		if c.mute.Load().(bool) || solo && !c.solo.Load().(bool) {
+			continue
+		}
+		c.mix(samples)
+	}
+	for _, bus := range buses {
+		bus.mix(samples)
+	}
+	s.master.process(samples)
+	for _, r := range recordings {
+		if r.source == nil {
+			r.process(samples)
+		}
 	}
 }
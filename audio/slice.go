@@ -0,0 +1,79 @@
+package audio
+
+import "fmt"
+
+const (
+	onsetWindow    = 512  // samples per energy measurement
+	onsetHistory   = 8    // windows in the average that an onset is compared to
+	onsetThreshold = 4    // minimum energy ratio to the average
+	onsetMinGap    = 0.05 // seconds
+	// onsetFloor is the minimum energy of an onset, which keeps noise in near
+	// silence from being detected.
+	onsetFloor = 1e-4 * onsetWindow
+)
+
+// EqualSlices returns the start points of n slices of equal length.
+func EqualSlices(snd *Sound, n int) ([]int, error) {
+	if n < 1 || n > numKeys {
+		return nil, fmt.Errorf("number of slices must be between 1 and %d: %d", numKeys, n)
+	}
+	if n > snd.len() {
+		return nil, fmt.Errorf("sound is too short for %d slices", n)
+	}
+	points := make([]int, n)
+	for i := range points {
+		points[i] = i * snd.len() / n
+	}
+	return points, nil
+}
+
+// Onsets returns the start points of the transients in snd, detected by jumps in
+// the energy of the signal. The first point is always the start of the sound.
+func Onsets(snd *Sound) []int {
+	points := []int{0}
+	minGap := int(onsetMinGap * snd.sampleRate)
+	var history [onsetHistory]float64
+	for n := 0; (n+1)*onsetWindow <= snd.len() && len(points) < numKeys; n++ {
+		start := n * onsetWindow
+		var energy, avg float64
+		for i := start; i < start+onsetWindow; i++ {
+			l, r := snd.bufs[0][i], snd.bufs[1][i]
+			energy += (l*l + r*r) / 2
+		}
+		for _, e := range history {
+			avg += e
+		}
+		avg /= onsetHistory
+		history[n%onsetHistory] = energy
+
+		last := points[len(points)-1]
+		if energy > onsetFloor && energy > onsetThreshold*avg && start-last >= minGap {
+			points = append(points, start)
+		}
+	}
+	return points
+}
+
+// Slice splits snd at points. The slices share the audio buffer of snd.
+func Slice(snd *Sound, points []int) []*Sound {
+	slices := make([]*Sound, len(points))
+	for n, start := range points {
+		end := snd.len()
+		if n+1 < len(points) {
+			end = points[n+1]
+		}
+		slices[n] = &Sound{
+			bufs:       [2][]float64{snd.bufs[0][start:end:end], snd.bufs[1][start:end:end]},
+			file:       snd.file,
+			loop:       loopOff,
+			sampleRate: snd.sampleRate,
+			slice:      &sliceInfo{start: start, end: end},
+		}
+	}
+	return slices
+}
+
+// sliceInfo is the position of a slice in the sound it was cut from, in samples.
+type sliceInfo struct {
+	start, end int
+}
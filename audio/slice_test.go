@@ -0,0 +1,53 @@
+package audio
+
+import (
+	"math"
+	"testing"
+)
+
+func TestOnsets(t *testing.T) {
+	hits := []int{0, 10000, 25000, 26000, 40000}
+	buf := make([]float64, 50000)
+	for _, hit := range hits {
+		for n := hit; n < len(buf); n++ {
+			buf[n] += math.Sin(float64(n)) * math.Exp(-float64(n-hit)/2000)
+		}
+	}
+	snd := &Sound{bufs: [2][]float64{buf, buf}, sampleRate: sampleRate}
+
+	// The hit at 26000 is within the minimum gap of the one before it
+	want := []int{0, 10000, 25000, 40000}
+	got := Onsets(snd)
+	if len(got) != len(want) {
+		t.Fatalf("wrong onsets: want %v, got %v", want, got)
+	}
+	for n := range want {
+		if got[n] > want[n] || want[n]-got[n] >= onsetWindow {
+			t.Errorf("onset %d: want the window of %v, got %v", n, want[n], got[n])
+		}
+	}
+}
+
+func TestSlice(t *testing.T) {
+	buf := make([]float64, 1000)
+	snd := &Sound{bufs: [2][]float64{buf, buf}, sampleRate: sampleRate}
+	points, err := EqualSlices(snd, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	slices := Slice(snd, points)
+	for n, s := range slices {
+		if s.len() != 250 {
+			t.Errorf("slice %d: wrong length: want 250, got %v", n, s.len())
+		}
+		if &s.bufs[0][0] != &buf[n*250] {
+			t.Errorf("slice %d is not a view into the sound", n)
+		}
+	}
+	if _, err := EqualSlices(snd, 0); err == nil {
+		t.Error("expected an error for 0 slices")
+	}
+	if err := (&SoundMapping{}).PutSlices(125, slices); err == nil {
+		t.Error("expected an error for slices past the last key")
+	}
+}
@@ -0,0 +1,90 @@
+package audio
+
+import "math"
+
+const (
+	grainSize = 2048 // samples, grains overlap by half
+	// A new grain starts within grainSearch samples of the play position, where
+	// the first grainMatch samples are most similar to how the previous grain
+	// continues (WSOLA). This avoids phase cancellation between grains.
+	grainSearch = 256
+	grainMatch  = 128
+)
+
+// grainWindow is a Hann window. Windows that overlap by half add up to 1.
+var grainWindow = func() []float64 {
+	w := make([]float64, grainSize)
+	for n := range w {
+		w[n] = 0.5 - 0.5*math.Cos(twoPi*float64(n)/grainSize)
+	}
+	return w
+}()
+
+// A grain plays a short, windowed part of a sound.
+type grain struct {
+	pos    float64
+	rate   float64
+	age    int
+	active bool
+}
+
+// startGrains starts a synced sound. The first grain starts at the peak of its
+// window, so the start of the sound isn't faded in.
+func (v *samplerVoice) startGrains() {
+	v.grains[0] = grain{pos: v.pos, rate: math.Copysign(v.grainRate, v.rate), age: grainSize / 2, active: true}
+	v.grains[1] = grain{}
+	v.sinceGrain = 0
+}
+
+// nextGrainSample returns the next sample of a synced sound. A new grain starts at
+// the current position every half grain, so the speed at which the position moves
+// sets the tempo, while the grains play at the pitch of the note.
+func (v *samplerVoice) nextGrainSample(interp interpolation) (left, right float64) {
+	if v.sinceGrain == 0 {
+		g, prev := &v.grains[0], &v.grains[1]
+		if g.active {
+			g, prev = prev, g
+		}
+		rate := math.Copysign(v.grainRate, v.rate)
+		*g = grain{pos: v.alignGrain(prev.pos, rate), rate: rate, active: true}
+	}
+	v.sinceGrain = (v.sinceGrain + 1) % (grainSize / 2)
+
+	for n := range v.grains {
+		g := &v.grains[n]
+		if !g.active {
+			continue
+		}
+		w := grainWindow[g.age]
+		left += interpolate(v.bufs[0], g.pos, g.rate, interp) * w
+		right += interpolate(v.bufs[1], g.pos, g.rate, interp) * w
+		g.pos += g.rate
+		g.age++
+		if g.age == grainSize {
+			g.active = false
+		}
+	}
+	return left, right
+}
+
+// alignGrain returns the start of a new grain near the play position that best
+// continues the waveform of the grain at prev. It prefers the play position
+// itself when there is no better match, like in silence.
+func (v *samplerVoice) alignGrain(prev, rate float64) float64 {
+	similarity := func(start float64) float64 {
+		var sum float64
+		for k := 0; k < grainMatch; k++ {
+			d := float64(k) * rate
+			sum += at(v.bufs[0], int(start+d)) * at(v.bufs[0], int(prev+d))
+		}
+		return sum
+	}
+	best, bestScore := v.pos, similarity(v.pos)
+	for offset := -grainSearch; offset <= grainSearch; offset += 2 {
+		start := v.pos + float64(offset)
+		if score := similarity(start); score > bestScore {
+			best, bestScore = start, score
+		}
+	}
+	return best
+}
@@ -1,118 +1,346 @@
 package audio
 
 import (
-	"fmt"
 	"math"
+	"math/rand"
 	"sync/atomic"
 )
 
 const (
-	propCutoff     = "cutoff"
-	propEnvAttack  = "env.attack"
-	propEnvDecay   = "env.decay"
-	propEnvSustain = "env.sustain"
-	propEnvRelease = "env.release"
-	propOsc1Wave   = "osc1.wave"
-	propOsc2Wave   = "osc2.wave"
+	propCutoff        = "cutoff"
+	propResonance     = "resonance"
+	propFilterMode    = "filter.mode"
+	propFilterSlope   = "filter.slope"
+	propFilterGain    = "filter.gain"
+	propFEnvAttack    = "fenv.attack"
+	propFEnvDecay     = "fenv.decay"
+	propFEnvSustain   = "fenv.sustain"
+	propFEnvRelease   = "fenv.release"
+	propFEnvAmount    = "fenv.amount"
+	propEnvAttack     = "env.attack"
+	propEnvDecay      = "env.decay"
+	propEnvSustain    = "env.sustain"
+	propEnvRelease    = "env.release"
+	propEnv2Attack    = "env2.attack"
+	propEnv2Decay     = "env2.decay"
+	propEnv2Sustain   = "env2.sustain"
+	propEnv2Release   = "env2.release"
+	propOsc2Sync      = "osc2.sync"
+	propMix           = "mix"
+	propUnison        = "unison"
+	propUnisonDetune  = "unison.detune"
+	propUnisonWidth   = "unison.width"
+	propLFO1Wave      = "lfo1.wave"
+	propLFO1Rate      = "lfo1.rate"
+	propLFO2Wave      = "lfo2.wave"
+	propLFO2Rate      = "lfo2.rate"
+	propModWheel      = "modwheel"
+	propOscWave       = "wave"
+	propOscTable      = "table"
+	propOscTablePos   = "table.pos"
+	propOscOctave     = "octave"
+	propOscCoarse     = "coarse"
+	propOscFine       = "fine"
+	propOscLevel      = "level"
+	propOscPulseWidth = "pw"
 )
 
+const maxUnison = 8
+
+// synthProps holds the properties shared by all voices of a synth.
+type synthProps struct {
+	cutoff       *atomic.Value
+	resonance    *atomic.Value
+	filterMode   *atomic.Value
+	filterSlope  *atomic.Value
+	filterGain   *atomic.Value
+	fenvAttack   *atomic.Value
+	fenvDecay    *atomic.Value
+	fenvSustain  *atomic.Value
+	fenvRelease  *atomic.Value
+	fenvAmount   *atomic.Value
+	envAttack    *atomic.Value
+	envDecay     *atomic.Value
+	envSustain   *atomic.Value
+	envRelease   *atomic.Value
+	env2Attack   *atomic.Value
+	env2Decay    *atomic.Value
+	env2Sustain  *atomic.Value
+	env2Release  *atomic.Value
+	osc1         oscProps
+	osc2         oscProps
+	osc2Sync     *atomic.Value
+	mix          *atomic.Value
+	unison       *atomic.Value
+	unisonDetune *atomic.Value
+	unisonWidth  *atomic.Value
+	lfo1Wave     *atomic.Value
+	lfo1Rate     *atomic.Value
+	lfo2Wave     *atomic.Value
+	lfo2Rate     *atomic.Value
+	modWheel     *atomic.Value
+	modSlots     []modSlot
+}
+
+// oscProps holds the properties of one oscillator. They're registered with the
+// oscillator name as prefix, e.g. osc1.coarse.
+type oscProps struct {
+	wave       *atomic.Value
+	table      *atomic.Value
+	tablePos   *atomic.Value
+	octave     *atomic.Value
+	coarse     *atomic.Value
+	fine       *atomic.Value
+	level      *atomic.Value
+	pulseWidth *atomic.Value
+}
+
+func registerOscProps(props *Props, name, wave string) oscProps {
+	prefix := name + "."
+	return oscProps{
+		wave:       props.MustRegister(prefix+propOscWave, setWaveform, wave),
+		table:      props.MustRegister(prefix+propOscTable, setWavetable, ""),
+		tablePos:   props.MustRegister(prefix+propOscTablePos, setFloat64(0, 1), 0.),
+		octave:     props.MustRegister(prefix+propOscOctave, setIntRange(-3, 3), 0),
+		coarse:     props.MustRegister(prefix+propOscCoarse, setFloat64(-24, 24), 0.),
+		fine:       props.MustRegister(prefix+propOscFine, setFloat64(-100, 100), 0.),
+		level:      props.MustRegister(prefix+propOscLevel, setFloat64(0, 1), 1.),
+		pulseWidth: props.MustRegister(prefix+propOscPulseWidth, setFloat64(0.05, 0.95), 0.5),
+	}
+}
+
+// ratio returns the frequency ratio for the oscillator tuning plus an offset in
+// semitones.
+func (p *oscProps) ratio(semitones float64) float64 {
+	semitones += 12*float64(p.octave.Load().(int)) +
+		p.coarse.Load().(float64) +
+		p.fine.Load().(float64)/100
+	return math.Pow(2, semitones/12)
+}
+
 func Synth(props *Props) *Instrument {
-	var (
-		cutoff     = props.MustRegister(propCutoff, setFloat64(0, 20_000), 1000.0)
-		envAttack  = props.MustRegister(propEnvAttack, setEnvParam, 0.01)
-		envDecay   = props.MustRegister(propEnvDecay, setEnvParam, 0.5)
-		envSustain = props.MustRegister(propEnvSustain, setFloat64(0, 1), 1.0)
-		envRelease = props.MustRegister(propEnvRelease, setEnvParam, 0.1)
-		osc1Wave   = props.MustRegister(propOsc1Wave, setWaveform, "saw")
-		osc2Wave   = props.MustRegister(propOsc2Wave, setWaveform, "square")
-	)
+	sp := &synthProps{
+		cutoff:       props.MustRegister(propCutoff, setFloat64(0, 20_000), 1000.0),
+		resonance:    props.MustRegister(propResonance, setFloat64(0.1, 20), 1.0),
+		filterMode:   props.MustRegister(propFilterMode, setFilterMode, "lowpass"),
+		filterSlope:  props.MustRegister(propFilterSlope, setFilterSlope, 12),
+		filterGain:   props.MustRegister(propFilterGain, setFloat64(-24, 24), 0.),
+		fenvAttack:   props.MustRegister(propFEnvAttack, setEnvParam, 0.001),
+		fenvDecay:    props.MustRegister(propFEnvDecay, setEnvParam, 0.3),
+		fenvSustain:  props.MustRegister(propFEnvSustain, setFloat64(0, 1), 0.),
+		fenvRelease:  props.MustRegister(propFEnvRelease, setEnvParam, 0.1),
+		fenvAmount:   props.MustRegister(propFEnvAmount, setFloat64(-10, 10), 0.),
+		envAttack:    props.MustRegister(propEnvAttack, setEnvParam, 0.01),
+		envDecay:     props.MustRegister(propEnvDecay, setEnvParam, 0.5),
+		envSustain:   props.MustRegister(propEnvSustain, setFloat64(0, 1), 1.0),
+		envRelease:   props.MustRegister(propEnvRelease, setEnvParam, 0.1),
+		env2Attack:   props.MustRegister(propEnv2Attack, setEnvParam, 0.01),
+		env2Decay:    props.MustRegister(propEnv2Decay, setEnvParam, 0.5),
+		env2Sustain:  props.MustRegister(propEnv2Sustain, setFloat64(0, 1), 0.),
+		env2Release:  props.MustRegister(propEnv2Release, setEnvParam, 0.1),
+		osc1:         registerOscProps(props, "osc1", "saw"),
+		osc2:         registerOscProps(props, "osc2", "square"),
+		osc2Sync:     props.MustRegister(propOsc2Sync, setBool, false),
+		mix:          props.MustRegister(propMix, setFloat64(0, 1), 0.5),
+		unison:       props.MustRegister(propUnison, setIntRange(1, maxUnison), 1),
+		unisonDetune: props.MustRegister(propUnisonDetune, setFloat64(0, 100), 20.),
+		unisonWidth:  props.MustRegister(propUnisonWidth, setFloat64(0, 1), 0.5),
+		lfo1Wave:     props.MustRegister(propLFO1Wave, setVoiceLFOWave, "sine"),
+		lfo1Rate:     props.MustRegister(propLFO1Rate, setFloat64(0.01, 50), 5.0),
+		lfo2Wave:     props.MustRegister(propLFO2Wave, setVoiceLFOWave, "triangle"),
+		lfo2Rate:     props.MustRegister(propLFO2Rate, setFloat64(0.01, 50), 0.5),
+		modWheel:     props.MustRegister(propModWheel, setFloat64(0, 1), 0.),
+		modSlots:     registerModSlots(props),
+	}
 	voices := make([]Voice, numVoices)
 	for n := range voices {
-		voices[n] = &synthVoice{
-			cutoff:     cutoff,
-			envAttack:  envAttack,
-			envDecay:   envDecay,
-			envSustain: envSustain,
-			envRelease: envRelease,
-			osc1Wave:   osc1Wave,
-			osc2Wave:   osc2Wave,
-			state:      stateFree,
-			osc1:       &osc{},
-			osc2:       &osc{},
-			filter:     &filter{coefficients: make([]float64, numCoefficients)},
-			env:        &envelope{},
-			buf:        make([]float64, bufferSize),
+		v := &synthVoice{
+			props:   sp,
+			state:   stateFree,
+			filters: [2]*filter{{}, {}},
+			env:     &envelope{},
+			fenv:    &envelope{},
+			env2:    &envelope{},
+			lfo1:    &voiceLFO{wave: sp.lfo1Wave, rate: sp.lfo1Rate},
+			lfo2:    &voiceLFO{wave: sp.lfo2Wave, rate: sp.lfo2Rate},
+			rand:    rand.New(rand.NewSource(int64(n))),
+			buf:     make([]float64, bufferSize),
+			out:     [2][]float64{make([]float64, bufferSize), make([]float64, bufferSize)},
+			resets:  make([]float64, bufferSize),
+		}
+		for u := range v.unison {
+			v.unison[u] = [2]*osc{{}, {}}
 		}
+		voices[n] = v
 	}
 	return NewInstrument(props, voices)
 }
 
 type synthVoice struct {
-	buf           []float64
-	cutoff        *atomic.Value
-	envAttack     *atomic.Value
-	envDecay      *atomic.Value
-	envSustain    *atomic.Value
-	envRelease    *atomic.Value
-	osc1Wave      *atomic.Value
-	osc2Wave      *atomic.Value
-	osc1          *osc
-	osc2          *osc
-	filter        *filter
+	props         *synthProps
+	buf           []float64          // scratch buffer for a single unison voice
+	out           [2][]float64       // scratch buffers for the stereo output of the voice
+	resets        []float64          // hard sync positions of osc1
+	unison        [maxUnison][2]*osc // osc1 and osc2 for each unison voice
+	numUnison     int
+	filters       [2]*filter // left and right
 	env           *envelope
+	fenv          *envelope
+	env2          *envelope
+	lfo1          *voiceLFO
+	lfo2          *voiceLFO
+	rand          *rand.Rand
 	state         voiceState
 	pitch         int
+	velocity      int
+	freq          float64
 	duration      int
 	samplesPlayed int
 }
 
 func (v *synthVoice) PlayNote(pitch, velocity, duration int) {
-	freq := midiToFreq(pitch)
+	p := v.props
 	v.pitch = pitch
+	v.velocity = velocity
+	v.freq = midiToFreq(pitch)
 	v.duration = duration
 	v.samplesPlayed = 0
-	v.env.attack = v.envAttack.Load().(float64)
-	v.env.decay = v.envDecay.Load().(float64)
-	v.env.sustain = v.envSustain.Load().(float64)
-	v.env.release = v.envRelease.Load().(float64)
+	v.env.attack = p.envAttack.Load().(float64)
+	v.env.decay = p.envDecay.Load().(float64)
+	v.env.sustain = p.envSustain.Load().(float64)
+	v.env.release = p.envRelease.Load().(float64)
 	v.env.startAttack()
+	v.fenv.attack = p.fenvAttack.Load().(float64)
+	v.fenv.decay = p.fenvDecay.Load().(float64)
+	v.fenv.sustain = p.fenvSustain.Load().(float64)
+	v.fenv.release = p.fenvRelease.Load().(float64)
+	v.fenv.startAttack()
+	v.env2.attack = p.env2Attack.Load().(float64)
+	v.env2.decay = p.env2Decay.Load().(float64)
+	v.env2.sustain = p.env2Sustain.Load().(float64)
+	v.env2.release = p.env2Release.Load().(float64)
+	v.env2.startAttack()
+	v.lfo1.reset()
+	v.lfo2.reset()
 	v.state = stateActive
 
-	phaseDelta := freq * twoPi / sampleRate
-	v.osc1.setWaveform(v.osc1Wave.Load().(string))
-	v.osc1.freq = freq
-	v.osc1.phaseDelta = phaseDelta
-	v.osc2.setWaveform(v.osc2Wave.Load().(string))
-	v.osc2.freq = freq
-	v.osc2.phaseDelta = phaseDelta
+	v.numUnison = p.unison.Load().(int)
+	for u := 0; u < v.numUnison; u++ {
+		osc1, osc2 := v.unison[u][0], v.unison[u][1]
+		osc1.setWaveform(p.osc1.wave.Load().(string))
+		osc2.setWaveform(p.osc2.wave.Load().(string))
+		osc1.table = p.osc1.table.Load().(*wavetable)
+		osc2.table = p.osc2.table.Load().(*wavetable)
+		osc1.phase, osc2.phase = 0, 0
+		if v.numUnison > 1 {
+			// Start unison voices at random phases so they don't sound like a
+			// single oscillator at the start of a note.
+			osc1.phase, osc2.phase = v.rand.Float64(), v.rand.Float64()
+		}
+	}
 }
 
 func (v *synthVoice) reset() {
 	v.pitch = 0
-	v.filter.y1 = 0.
-	v.filter.y2 = 0.
-	v.osc1.freq = 0
-	v.osc1.phaseDelta = 0
-	v.osc2.freq = 0
-	v.osc2.phaseDelta = 0
+	v.filters[0].reset()
+	v.filters[1].reset()
 	v.state = stateFree
 }
 
-func (v *synthVoice) Process(buf []float64) {
-	v.filter.calculateCoefficients(v.cutoff.Load().(float64))
-	tmp := v.buf[0:len(buf)]
-	v.osc1.process(tmp)
-	v.osc2.process(tmp)
-	v.filter.process(tmp)
-	v.env.process(tmp)
-	v.samplesPlayed += len(buf)
-	for n := range tmp {
-		buf[n] += 0.1 * tmp[n]
-		tmp[n] = 0
+// modulate evaluates the modulation matrix and advances the modulation sources by
+// n samples.
+func (v *synthVoice) modulate(n int) [numModDests]float64 {
+	var sources [numModSources]float64
+	for i := 0; i < n; i++ {
+		sources[modSourceFEnv] = v.fenv.value()
+		sources[modSourceEnv2] = v.env2.value()
 	}
+	sources[modSourceLFO1] = v.lfo1.next(n)
+	sources[modSourceLFO2] = v.lfo2.next(n)
+	sources[modSourceVelocity] = float64(v.velocity) / 127
+	sources[modSourceKey] = float64(v.pitch-60) / 12
+	sources[modSourceModWheel] = v.props.modWheel.Load().(float64)
+	return modMatrix(v.props.modSlots, &sources)
+}
+
+func (v *synthVoice) Process(left, right []float64) {
+	p := v.props
+	mods := v.modulate(len(left))
+
+	fenv := p.fenvAmount.Load().(float64) * v.fenv.val
+	cutoff := p.cutoff.Load().(float64) * math.Pow(2, fenv+mods[modDestCutoff])
+	q := clamp(p.resonance.Load().(float64)+mods[modDestResonance], 0.1, 40)
+	for _, f := range v.filters {
+		f.slope = p.filterSlope.Load().(int)
+		f.calculateCoefficients(
+			p.filterMode.Load().(string),
+			clamp(cutoff, 20, 20_000),
+			q,
+			p.filterGain.Load().(float64),
+		)
+	}
+
+	mix := clamp(p.mix.Load().(float64)+mods[modDestMix], 0, 1)
+	level1 := p.osc1.level.Load().(float64) * math.Min(1, 2*(1-mix))
+	level2 := p.osc2.level.Load().(float64) * math.Min(1, 2*mix)
+	ratio1 := p.osc1.ratio(mods[modDestPitch])
+	ratio2 := p.osc2.ratio(mods[modDestPitch])
+	pos1 := clamp(p.osc1.tablePos.Load().(float64)+mods[modDestOsc1Pos], 0, 1)
+	pos2 := clamp(p.osc2.tablePos.Load().(float64)+mods[modDestOsc2Pos], 0, 1)
+	pw1 := clamp(p.osc1.pulseWidth.Load().(float64)+mods[modDestPulseWidth], 0.05, 0.95)
+	pw2 := clamp(p.osc2.pulseWidth.Load().(float64)+mods[modDestPulseWidth], 0.05, 0.95)
+	sync := p.osc2Sync.Load().(bool)
+	detune := p.unisonDetune.Load().(float64)
+	width := p.unisonWidth.Load().(float64)
+
+	// Unison voices are spread evenly over the detune and stereo range and mixed at
+	// equal power.
+	gain := 1 / math.Sqrt(float64(v.numUnison))
+	tmp := v.buf[:len(left)]
+	outL, outR := v.out[0][:len(left)], v.out[1][:len(left)]
+	for u := 0; u < v.numUnison; u++ {
+		spread := 0.
+		if v.numUnison > 1 {
+			spread = 2*float64(u)/float64(v.numUnison-1) - 1
+		}
+		unison := math.Pow(2, spread*detune/1200)
+		osc1, osc2 := v.unison[u][0], v.unison[u][1]
+		osc1.phaseDelta = v.freq * ratio1 * unison / sampleRate
+		osc2.phaseDelta = v.freq * ratio2 * unison / sampleRate
+		osc1.tablePos, osc2.tablePos = pos1, pos2
+		osc1.pulseWidth, osc2.pulseWidth = pw1, pw2
+		osc1.resets = v.resets[:len(left)]
+		osc2.syncTo = nil
+		if sync {
+			osc2.syncTo = osc1.resets
+		}
+		osc1.process(tmp, level1)
+		osc2.process(tmp, level2)
+
+		gl, gr := panGains(spread * width)
+		for n := range tmp {
+			outL[n] += gain * gl * tmp[n]
+			outR[n] += gain * gr * tmp[n]
+			tmp[n] = 0
+		}
+	}
+	v.filters[0].process(outL)
+	v.filters[1].process(outR)
+
+	amp := 0.1 * math.Max(0, 1+mods[modDestAmp])
+	for n := range outL {
+		env := amp * v.env.value()
+		left[n] += env * outL[n]
+		right[n] += env * outR[n]
+		outL[n] = 0
+		outR[n] = 0
+	}
+	v.samplesPlayed += len(left)
 	if v.samplesPlayed >= v.duration && v.state != stateReleased {
 		v.state = stateReleased
 		v.env.startRelease()
+		v.fenv.startRelease()
+		v.env2.startRelease()
 	}
 	if v.state == stateReleased && v.env.state == stateInit {
 		v.reset()
@@ -134,112 +362,6 @@ func (v *synthVoice) stop() {
 
 func (v *synthVoice) State() voiceState { return v.state }
 
-const (
-	twoPi           = 2 * math.Pi
-	numCoefficients = 5
-)
-
-type osc struct {
-	wave       string
-	phase      float64
-	phaseDelta float64
-	freq       float64
-	fn         func(float64) float64
-}
-
-func (o *osc) process(buf []float64) {
-	for n := range buf {
-		buf[n] += o.fn(o.phase)
-		o.phase += o.phaseDelta
-		if o.phase >= twoPi {
-			o.phase -= twoPi
-		}
-	}
-}
-
-func (o *osc) setWaveform(s string) {
-	switch s {
-	case "sine":
-		o.fn = math.Sin
-	case "saw":
-		o.fn = func(phase float64) float64 {
-			return (2.0 * o.phase / twoPi) - 1.
-		}
-	case "square":
-		o.fn = func(phase float64) float64 {
-			if phase <= math.Pi {
-				return 1.0
-			} else {
-				return -1.0
-			}
-		}
-	case "off":
-		o.fn = func(_ float64) float64 { return 0 }
-	}
-}
-
-func setWaveform(v interface{}, dest *atomic.Value) error {
-	s, ok := v.(string)
-	if !ok {
-		return fmt.Errorf("value is not a string: %v", v)
-	}
-	switch s {
-	case "sine", "saw", "square", "off":
-		dest.Store(s)
-		return nil
-	default:
-		return fmt.Errorf("not a valid waveform type: %v", s)
-	}
-}
-
-type filter struct {
-	coefficients []float64
-
-	// state
-	y1, y2 float64 // y[n-1] y[n-2]
-}
-
-// Lowpass filter based on https://www.w3.org/2011/audio/audio-eq-cookbook.html
-func (f *filter) process(buf []float64) {
-	c0 := f.coefficients[0]
-	c1 := f.coefficients[1]
-	c2 := f.coefficients[2]
-	c3 := f.coefficients[3]
-	c4 := f.coefficients[4]
-
-	for n := range buf {
-		in := buf[n]
-		out := c0*in + f.y1
-		buf[n] = out
-		f.y1 = c1*in - c3*out + f.y2
-		f.y2 = c2*in - c4*out
-	}
-}
-
-func (f *filter) calculateCoefficients(freq float64) {
-	omega := 2 * math.Pi * freq / sampleRate
-	cos := math.Cos(omega)
-	sin := math.Sin(omega)
-
-	const q = 1
-	alpha := sin / (2. * q)
-
-	var b0, b1, b2, a0, a1, a2 float64
-
-	b0 = (1 - cos) / 2
-	b1 = 1 - cos
-	b2 = b0
-	a0 = 1 + alpha
-	a1 = -2 * cos
-	a2 = 1 - alpha
-
-	f.coefficients[0] = b0 / a0
-	f.coefficients[1] = b1 / a0
-	f.coefficients[2] = b2 / a0
-	f.coefficients[3] = a1 / a0
-	f.coefficients[4] = a2 / a0
-}
-
 func midiToFreq(note int) float64 {
 	f := math.Pow(2, float64((note-69))/12.0) * 440
 	return f
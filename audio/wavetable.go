@@ -0,0 +1,159 @@
+package audio
+
+import (
+	"fmt"
+	"math"
+	"math/cmplx"
+	"sync/atomic"
+)
+
+const (
+	tableSize   = 2048 // samples per frame, the size used by most wavetable synths
+	tableLevels = 10   // one mip-map level per octave
+	maxFrames   = 256
+)
+
+// wavetable holds one or more single cycle waveforms (frames). Each frame is stored
+// as a mip-map, where every next level contains half the harmonics of the previous
+// level, so the oscillator can pick a level that doesn't alias.
+type wavetable struct {
+	file   string
+	frames [][tableLevels][]float64 // each table has tableSize+1 samples to simplify interpolation
+}
+
+// loadWavetable reads a wavetable from a sound file. Files shorter than two frames
+// are treated as a single cycle of any length, longer files are split into frames
+// of tableSize samples.
+func loadWavetable(file string) (*wavetable, error) {
+	snd, err := LoadSound(file)
+	if err != nil {
+		return nil, err
+	}
+	buf := snd.bufs[0] // the left channel of stereo files
+	var frames [][]float64
+	switch {
+	case len(buf) == 0:
+		return nil, fmt.Errorf("wavetable is empty: %s", file)
+	case len(buf) < 2*tableSize:
+		frames = append(frames, buf)
+	case len(buf)%tableSize != 0:
+		return nil, fmt.Errorf("wavetable length is not a multiple of %d samples: %s", tableSize, file)
+	default:
+		for n := 0; n < len(buf); n += tableSize {
+			frames = append(frames, buf[n:n+tableSize])
+		}
+	}
+	if len(frames) > maxFrames {
+		return nil, fmt.Errorf("wavetable has more than %d frames: %s", maxFrames, file)
+	}
+	wt := &wavetable{file: file}
+	for _, frame := range frames {
+		wt.frames = append(wt.frames, mipmap(frame))
+	}
+	return wt, nil
+}
+
+// mipmap resynthesizes a single cycle at tableSize samples for every level.
+func mipmap(cycle []float64) [tableLevels][]float64 {
+	spectrum := harmonics(cycle, tableSize/2)
+	scale := complex(float64(tableSize)/float64(len(cycle)), 0)
+
+	var levels [tableLevels][]float64
+	x := make([]complex128, tableSize)
+	for level := range levels {
+		for n := range x {
+			x[n] = 0
+		}
+		// The DC offset is dropped and the highest harmonic of level 0 is just below
+		// Nyquist.
+		for h := 1; h < (tableSize/2)>>level && h < len(spectrum); h++ {
+			x[h] = spectrum[h] * scale
+			x[tableSize-h] = cmplx.Conj(x[h])
+		}
+		ifft(x)
+		table := make([]float64, tableSize+1)
+		for n := 0; n < tableSize; n++ {
+			table[n] = real(x[n])
+		}
+		table[tableSize] = table[0]
+		levels[level] = table
+	}
+	return levels
+}
+
+// harmonics returns the first n bins of the Fourier transform of cycle.
+func harmonics(cycle []float64, n int) []complex128 {
+	size := len(cycle)
+	if size&(size-1) == 0 && size >= n {
+		x := make([]complex128, size)
+		for i, s := range cycle {
+			x[i] = complex(s, 0)
+		}
+		fft(x)
+		return x[:n]
+	}
+	// Fall back to a plain DFT for cycles that aren't a power of 2 long. This is
+	// only done once for single cycle waveforms, so speed isn't a concern.
+	if n > size/2 {
+		n = size / 2
+	}
+	spectrum := make([]complex128, n)
+	for h := range spectrum {
+		for i, s := range cycle {
+			spectrum[h] += complex(s, 0) * cmplx.Rect(1, -twoPi*float64(h*i)/float64(size))
+		}
+	}
+	return spectrum
+}
+
+// level returns the mip-map level that doesn't alias for the given phase delta.
+func (wt *wavetable) level(phaseDelta float64) int {
+	allowed := 0.5 / phaseDelta // number of harmonics below Nyquist
+	level := 0
+	for level < tableLevels-1 && float64(int(tableSize/2)>>level) > allowed {
+		level++
+	}
+	return level
+}
+
+// value returns the sample at phase t for table position pos, which morphs between
+// the frames of the wavetable.
+func (wt *wavetable) value(level int, pos, t float64) float64 {
+	fpos := pos * float64(len(wt.frames)-1)
+	frame := int(fpos)
+	if frame >= len(wt.frames)-1 {
+		return lookup(wt.frames[len(wt.frames)-1][level], t)
+	}
+	a := lookup(wt.frames[frame][level], t)
+	b := lookup(wt.frames[frame+1][level], t)
+	return a + (fpos-float64(frame))*(b-a)
+}
+
+func lookup(table []float64, t float64) float64 {
+	idx := t * tableSize
+	i := int(idx)
+	frac := idx - float64(i)
+	return table[i] + frac*(table[i+1]-table[i])
+}
+
+func setWavetable(v interface{}, dest *atomic.Value) error {
+	s, ok := v.(string)
+	if !ok {
+		return fmt.Errorf("value is not a string: %v", v)
+	}
+	if s == "" {
+		dest.Store((*wavetable)(nil))
+		return nil
+	}
+	wt, err := loadWavetable(s)
+	if err != nil {
+		return err
+	}
+	dest.Store(wt)
+	return nil
+}
+
+// clamp limits v to the range min - max.
+func clamp(v, min, max float64) float64 {
+	return math.Max(min, math.Min(v, max))
+}
@@ -0,0 +1,51 @@
+package audio
+
+import (
+	"math"
+	"math/cmplx"
+	"testing"
+)
+
+func TestMipmap(t *testing.T) {
+	// AKWF style single cycle, which is not a power of 2 long.
+	cycle := make([]float64, 600)
+	for n := range cycle {
+		cycle[n] = 2*float64(n)/600 - 1
+	}
+	levels := mipmap(cycle)
+	for level, table := range levels {
+		if len(table) != tableSize+1 {
+			t.Fatalf("level %d: wrong table size: %d", level, len(table))
+		}
+		x := make([]complex128, tableSize)
+		for n := range x {
+			x[n] = complex(table[n], 0)
+		}
+		fft(x)
+		max := int(tableSize/2) >> level
+		for h := 1; h < tableSize/2; h++ {
+			mag := cmplx.Abs(x[h]) / (tableSize / 2)
+			if h >= max && mag > 1e-9 {
+				t.Errorf("level %d: unexpected harmonic %d with magnitude %v", level, h, mag)
+			}
+			// The harmonics of a saw wave have an amplitude of 2/(pi*h)
+			if h < max && h < 300 && math.Abs(mag-2/(math.Pi*float64(h))) > 0.01 {
+				t.Errorf("level %d: harmonic %d has wrong magnitude %v", level, h, mag)
+			}
+		}
+	}
+}
+
+func TestWavetableLevel(t *testing.T) {
+	wt := &wavetable{}
+	if want, got := 0, wt.level(20./sampleRate); want != got {
+		t.Errorf("wrong level for low note: want %v, got %v", want, got)
+	}
+	if want, got := tableLevels-1, wt.level(15_000./sampleRate); want != got {
+		t.Errorf("wrong level for high note: want %v, got %v", want, got)
+	}
+	// 1000 Hz allows 22 harmonics, so we need the level with 16
+	if want, got := 6, wt.level(1000./sampleRate); want != got {
+		t.Errorf("wrong level for 1000 Hz: want %v, got %v", want, got)
+	}
+}
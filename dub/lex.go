@@ -19,6 +19,7 @@ const (
 	typeLeftCurly
 	typeRightCurly
 	typeDash
+	typeColon
 	typeEOF
 )
 
@@ -30,6 +31,7 @@ var simpleTokens = map[rune]tokenType{
 	'{': typeLeftCurly,
 	'}': typeRightCurly,
 	'-': typeDash,
+	':': typeColon,
 }
 
 type token struct {
@@ -178,7 +180,7 @@ func (l *lexer) lexNumber() {
 	l.take(digits)
 
 	r := l.peek()
-	if r == ' ' || r == ']' || r == '}' || r == eof {
+	if r == ' ' || r == ']' || r == '}' || r == ':' || r == eof {
 		l.yieldToken(typeNumber)
 	} else {
 		l.invalidChar(r)
@@ -65,6 +65,17 @@ func TestLexer(t *testing.T) {
 				token{typ: typeEOF},
 			},
 		},
+		{
+			input: `[42:40]`,
+			expect: []token{
+				token{typ: typeLeftBracket, text: "["},
+				token{typ: typeNumber, text: "42"},
+				token{typ: typeColon, text: ":"},
+				token{typ: typeNumber, text: "40"},
+				token{typ: typeRightBracket, text: "]"},
+				token{typ: typeEOF},
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Log(test.input)
@@ -15,6 +15,7 @@ func (String) isNode()     {}
 func (Array) isNode()      {}
 func (Tuple) isNode()      {}
 func (Rest) isNode()       {}
+func (Note) isNode()       {}
 
 type Identifier string
 type Number float64
@@ -23,6 +24,12 @@ type Array []Node
 type Tuple []Node
 type Rest struct{}
 
+// Note is a pitch with a velocity, written as pitch:velocity in patterns.
+type Note struct {
+	Pitch    Number
+	Velocity Number
+}
+
 type Command struct {
 	Name Identifier
 	Args []Node
@@ -88,11 +95,11 @@ func (p *parser) array() (Array, error) {
 	for token = p.next(); token.typ != typeEOF; token = p.next() {
 		switch token.typ {
 		case typeNumber:
-			f, err := strconv.ParseFloat(token.text, 64)
+			n, err := p.note(token)
 			if err != nil {
 				return array, err
 			}
-			array = append(array, Number(f))
+			array = append(array, n)
 		case typeRightBracket:
 			return array, nil
 		case typeLeftBracket:
@@ -122,11 +129,11 @@ func (p *parser) tuple() (Tuple, error) {
 	for token = p.next(); token.typ != typeEOF; token = p.next() {
 		switch token.typ {
 		case typeNumber:
-			f, err := strconv.ParseFloat(token.text, 64)
+			n, err := p.note(token)
 			if err != nil {
 				return tuple, err
 			}
-			tuple = append(tuple, Number(f))
+			tuple = append(tuple, n)
 		case typeRightCurly:
 			return tuple, nil
 		default:
@@ -136,6 +143,27 @@ func (p *parser) tuple() (Tuple, error) {
 	return nil, unexpected(token)
 }
 
+// note parses a number in a pattern, which is a Note if a velocity follows it.
+func (p *parser) note(pitch token) (Node, error) {
+	f, err := strconv.ParseFloat(pitch.text, 64)
+	if err != nil {
+		return nil, err
+	}
+	if p.tokens[p.pos].typ != typeColon {
+		return Number(f), nil
+	}
+	p.next()
+	token := p.next()
+	if token.typ != typeNumber {
+		return nil, unexpected(token)
+	}
+	v, err := strconv.ParseFloat(token.text, 64)
+	if err != nil {
+		return nil, err
+	}
+	return Note{Pitch: Number(f), Velocity: Number(v)}, nil
+}
+
 func unexpected(t token) error {
 	return fmt.Errorf("unexpected token %q at position %d", t.text, t.pos)
 }
@@ -25,6 +25,18 @@ func TestParse(t *testing.T) {
 				Args: []Node{String("")},
 			},
 		},
+		{
+			input: `loop hats sam1 1 [42:40 - {36:127 42}]`,
+			want: Command{
+				Name: Identifier("loop"),
+				Args: []Node{
+					Identifier("hats"),
+					Identifier("sam1"),
+					Number(1),
+					Array{Note{42, 40}, Rest{}, Tuple{Note{36, 127}, Number(42)}},
+				},
+			},
+		},
 	}
 	for _, test := range tests {
 		t.Log(test.input)
@@ -36,4 +48,9 @@ func TestParse(t *testing.T) {
 			t.Errorf("\nwant: %+v\ngot:  %+v", test.want, got)
 		}
 	}
+	for _, input := range []string{`loop a b 1 [42:]`, `loop a b 1 [42:x]`} {
+		if _, err := Parse(input); err == nil {
+			t.Errorf("%s: expected an error", input)
+		}
+	}
 }
@@ -5,7 +5,6 @@ go 1.13
 require (
 	github.com/chzyer/readline v0.0.0-20180603132655-2972be24d48e
 	github.com/gordonklaus/portaudio v0.0.0-20180817120803-00e7307ccd93
-	github.com/youpy/go-riff v0.0.0-20131220112943-557d78c11efb // indirect
-	github.com/youpy/go-wav v0.0.0-20160223082350-b63a9887d320
-	golang.org/x/sys v0.0.0-20200409092240-59c9f1ba88fa // indirect
+	github.com/jfreymuth/oggvorbis v1.0.5
+	github.com/mewkiz/flac v1.0.12
 )
@@ -16,28 +16,35 @@ func main() {
 	flag.Parse()
 
 	seq := audio.NewSequencer(audio.NewProps())
-	sam1 := audio.Sampler(audio.NewProps())
+	sam1 := audio.Sampler(audio.NewProps(), seq)
 	syn1 := audio.Synth(audio.NewProps())
 	syn2 := audio.Synth(audio.NewProps())
-
-	env := env{
-		sequencer: seq,
-		devices: map[string]audio.Device{
-			"seq":  seq,
-			"syn1": syn1,
-			"syn2": syn2,
-			"sam1": sam1,
-		},
-	}
+	fm1 := audio.FM(audio.NewProps())
+	drm1 := audio.Drums(audio.NewProps())
 
 	sink, err := audio.NewSink()
 	if err != nil {
 		log.Fatal(err)
 	}
 
-	sink.AddSources(syn1, syn2, sam1)
+	sink.AddSources(syn1, syn2, fm1, sam1, drm1)
 	sink.AddTicker(seq)
 
+	env := env{
+		sequencer: seq,
+		sink:      sink,
+		out:       os.Stdout,
+		devices: map[string]audio.Device{
+			"seq":    seq,
+			"syn1":   syn1,
+			"syn2":   syn2,
+			"fm1":    fm1,
+			"sam1":   sam1,
+			"drm1":   drm1,
+			"master": sink.Master(),
+		},
+	}
+
 	if len(*run) != 0 {
 		if err := loadFile(&env, *run); err != nil {
 			fmt.Fprintln(os.Stderr, err)
@@ -4,7 +4,10 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/chzyer/readline"
 	"github.com/mrdg/vibe/audio"
@@ -13,7 +16,14 @@ import (
 
 type env struct {
 	sequencer *audio.Sequencer
+	sink      *audio.Sink
 	devices   map[string]audio.Device
+	// out receives messages from background work. The repl points it at the
+	// readline output, so messages don't garble the prompt.
+	out io.Writer
+	// mu serializes commands with updates from background work, like finished
+	// recordings.
+	mu sync.Mutex
 }
 
 func (e *env) setProp(device, prop string, v interface{}) error {
@@ -33,6 +43,8 @@ func (e *env) getProp(device, prop string) (interface{}, error) {
 }
 
 func (e *env) eval(input string) (dub.Node, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
 	command, err := dub.Parse(input)
 	if err != nil {
 		return nil, err
@@ -67,6 +79,9 @@ func repl(env *env) error {
 		return err
 	}
 	defer rl.Close()
+	env.mu.Lock()
+	env.out = rl.Stdout()
+	env.mu.Unlock()
 
 	for {
 		line, err := rl.Readline()
@@ -97,7 +112,30 @@ type command struct {
 var commands = []command{
 	{"loop", loopCommand, -3},
 	{"set", setCommand, 3},
-	{"load-sound", loadSoundCommand, 3},
+	{"preset", presetCommand, 2},
+	{"load-sound", loadSoundCommand, -3},
+	{"load-zone", loadZoneCommand, 5},
+	{"load-kit", loadKitCommand, -2},
+	{"sounds", soundsCommand, 1},
+	{"slice", sliceCommand, 4},
+	{"resample", resampleCommand, -3},
+	{"lfo", lfoCommand, 1},
+	{"route", routeCommand, 5},
+	{"unroute", unrouteCommand, 3},
+	{"bus", busCommand, 1},
+	{"send", sendCommand, 3},
+	{"insert", insertCommand, -3},
+	{"remove", removeCommand, 2},
+	{"move", moveCommand, 3},
+	{"chain", chainCommand, 1},
+	{"sidechain", sidechainCommand, -1},
+	{"gain", gainCommand, 2},
+	{"pan", panCommand, 2},
+	{"mute", switchCommand(audio.PropMute, true), 1},
+	{"unmute", switchCommand(audio.PropMute, false), 1},
+	{"solo", switchCommand(audio.PropSolo, true), 1},
+	{"unsolo", switchCommand(audio.PropSolo, false), 1},
+	{"meters", metersCommand, 0},
 }
 
 func setCommand(env *env, args []dub.Node) (dub.Node, error) {
@@ -117,27 +155,586 @@ func setCommand(env *env, args []dub.Node) (dub.Node, error) {
 	}
 }
 
+func presetCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device, name string
+	if err := readArgs(args, &device, &name); err != nil {
+		return nil, err
+	}
+	dev, ok := env.devices[device]
+	if !ok {
+		return nil, fmt.Errorf("unknown device: %s", device)
+	}
+	return nil, audio.LoadPreset(name, dev)
+}
+
+// loadSoundCommand maps a sound to a key. With a velocity range, the sound is
+// added as a layer of the key instead of replacing its sounds. Loading multiple
+// sounds for the same range plays them in turns.
 func loadSoundCommand(env *env, args []dub.Node) (dub.Node, error) {
 	var device, file string
-	var key int
-	if err := readArgs(args, &device, &file, &key); err != nil {
+	var key, velLow, velHigh int
+	var err error
+	switch len(args) {
+	case 3:
+		err = readArgs(args, &device, &file, &key)
+	case 5:
+		err = readArgs(args, &device, &file, &key, &velLow, &velHigh)
+	default:
+		err = errors.New("expected a device, file, key and optional velocity range")
+	}
+	if err != nil {
+		return nil, err
+	}
+	sound, err := audio.LoadSound(file)
+	if err != nil {
+		return nil, err
+	}
+	return nil, env.updateSoundMapping(device, func(m *audio.SoundMapping) error {
+		if len(args) == 3 {
+			return m.Put(key, sound)
+		}
+		return m.AddLayer(key, velLow, velHigh, sound)
+	})
+}
+
+func loadZoneCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device, file string
+	var root, low, high int
+	if err := readArgs(args, &device, &file, &root, &low, &high); err != nil {
+		return nil, err
+	}
+	sound, err := audio.LoadSound(file)
+	if err != nil {
+		return nil, err
+	}
+	return nil, env.updateSoundMapping(device, func(m *audio.SoundMapping) error {
+		return m.PutZone(root, low, high, sound)
+	})
+}
+
+// loadKitCommand maps the sounds in a directory to keys, starting at an optional
+// start key.
+func loadKitCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device, dir string
+	var startKey int
+	var err error
+	switch len(args) {
+	case 2:
+		err = readArgs(args, &device, &dir)
+	case 3:
+		err = readArgs(args, &device, &dir, &startKey)
+	default:
+		err = errors.New("expected a device, directory and optional start key")
+	}
+	if err != nil {
+		return nil, err
+	}
+	kit, err := audio.LoadKit(dir, startKey)
+	if err != nil {
+		return nil, err
+	}
+	dev, ok := env.devices[device]
+	if !ok {
+		return nil, fmt.Errorf("unknown device: %s", device)
+	}
+	// Check all key properties first, so a bad manifest doesn't leave the kit
+	// half loaded
+	props := make(map[string]interface{})
+	for _, ks := range kit {
+		key := strconv.Itoa(ks.Key)
+		props["level."+key] = ks.Level
+		props["choke."+key] = 0
+		if ks.Choke != audio.NoChoke {
+			props["choke."+key] = ks.Choke
+		}
+	}
+	for prop, v := range props {
+		if err := dev.Validate(prop, v); err != nil {
+			return nil, err
+		}
+	}
+	err = env.updateSoundMapping(device, func(m *audio.SoundMapping) error {
+		for _, ks := range kit {
+			if err := m.Put(ks.Key, ks.Sound); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	for prop, v := range props {
+		if err := dev.Set(prop, v); err != nil {
+			return nil, err
+		}
+	}
+	return nil, nil
+}
+
+func soundsCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device string
+	if err := readArgs(args, &device); err != nil {
 		return nil, err
 	}
 	v, err := env.getProp(device, audio.PropSoundMap)
 	if err != nil {
 		return nil, err
 	}
+	return dub.String(v.(*audio.SoundMapping).String()), nil
+}
+
+// sliceCommand cuts a sound into equal parts or at its onsets, and maps the
+// slices to consecutive keys. It returns the slice points.
+func sliceCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device, file string
+	var startKey int
+	if err := readArgs(args[:3], &device, &file, &startKey); err != nil {
+		return nil, err
+	}
 	sound, err := audio.LoadSound(file)
 	if err != nil {
 		return nil, err
 	}
+	var points []int
+	switch v := args[3].(type) {
+	case dub.Number:
+		if points, err = audio.EqualSlices(sound, int(v)); err != nil {
+			return nil, err
+		}
+	case dub.Identifier:
+		if v != "onsets" {
+			return nil, fmt.Errorf("expected a number of slices or onsets: %s", v)
+		}
+		points = audio.Onsets(sound)
+	default:
+		return nil, errors.New("expected a number of slices or onsets")
+	}
+	err = env.updateSoundMapping(device, func(m *audio.SoundMapping) error {
+		return m.PutSlices(startKey, audio.Slice(sound, points))
+	})
+	if err != nil {
+		return nil, err
+	}
+	var result strings.Builder
+	for n, p := range points {
+		fmt.Fprintf(&result, "%d: %d\n", startKey+n, p)
+	}
+	return dub.String(strings.TrimSuffix(result.String(), "\n")), nil
+}
+
+// resampleCommand records a number of bars of the output, or of a single device,
+// and maps the recording to a key of a sampler. The recording starts at the next
+// bar and is optionally saved to a file. The command returns right away.
+func resampleCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device string
+	var key, bars int
+	if err := readArgs(args[:3], &device, &key, &bars); err != nil {
+		return nil, err
+	}
+	source, file := "master", ""
+	var err error
+	switch len(args) {
+	case 3:
+	case 4:
+		err = readArgs(args[3:], &source)
+	case 5:
+		err = readArgs(args[3:], &source, &file)
+	default:
+		err = errors.New("expected a device, key, bars and optional source and file")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, err := env.getProp(device, audio.PropSoundMap); err != nil {
+		return nil, err
+	}
+	if err := audio.CheckKey(key); err != nil {
+		return nil, err
+	}
+	var src audio.Source
+	if source != "master" {
+		// Only sources with a mixer channel are rendered
+		if _, err := env.channel(source); err != nil {
+			return nil, err
+		}
+		src = env.devices[source].(audio.Source)
+	}
+	rec, done, err := env.sink.Record(env.sequencer, src, bars)
+	if err != nil {
+		return nil, err
+	}
+	go func() {
+		sound := <-done
+		env.sink.StopRecording(rec)
+		env.mu.Lock()
+		defer env.mu.Unlock()
+		if err := env.finishResample(device, key, file, sound); err != nil {
+			fmt.Fprintln(env.out, "resample error:", err)
+			return
+		}
+		if rec.Truncated() {
+			fmt.Fprintf(env.out, "resampled %s to %s %d, cut short because the tempo dropped\n", source, device, key)
+			return
+		}
+		fmt.Fprintf(env.out, "resampled %d bars of %s to %s %d\n", bars, source, device, key)
+	}()
+	return nil, nil
+}
+
+func (e *env) finishResample(device string, key int, file string, sound *audio.Sound) error {
+	if file != "" {
+		if err := audio.SaveSound(file, sound); err != nil {
+			return err
+		}
+	}
+	return e.updateSoundMapping(device, func(m *audio.SoundMapping) error {
+		return m.Put(key, sound)
+	})
+}
+
+// updateSoundMapping applies update to a copy of the sound mapping of device and
+// stores the result.
+func (e *env) updateSoundMapping(device string, update func(*audio.SoundMapping) error) error {
+	v, err := e.getProp(device, audio.PropSoundMap)
+	if err != nil {
+		return err
+	}
 	mapping, ok := v.(*audio.SoundMapping)
 	if !ok {
-		return nil, fmt.Errorf("cannot convert %v to sound mapping", v)
+		return fmt.Errorf("cannot convert %v to sound mapping", v)
 	}
 	copy := *mapping
-	copy.Put(key, sound)
-	return nil, env.setProp(device, audio.PropSoundMap, &copy)
+	if err := update(&copy); err != nil {
+		return err
+	}
+	return e.setProp(device, audio.PropSoundMap, &copy)
+}
+
+func lfoCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var name string
+	if err := readArgs(args, &name); err != nil {
+		return nil, err
+	}
+	if _, ok := env.devices[name]; ok {
+		return nil, fmt.Errorf("device already exists: %s", name)
+	}
+	lfo := audio.NewLFO(audio.NewProps(), env.sequencer)
+	env.devices[name] = lfo
+	env.sink.AddTicker(lfo)
+	return nil, nil
+}
+
+func routeCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var name, device, prop string
+	var min, max float64
+	if err := readArgs(args, &name, &device, &prop, &min, &max); err != nil {
+		return nil, err
+	}
+	lfo, err := env.lfo(name)
+	if err != nil {
+		return nil, err
+	}
+	dev, ok := env.devices[device]
+	if !ok {
+		return nil, fmt.Errorf("unknown device: %s", device)
+	}
+	return nil, lfo.Route(dev, prop, min, max)
+}
+
+func unrouteCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var name, device, prop string
+	if err := readArgs(args, &name, &device, &prop); err != nil {
+		return nil, err
+	}
+	lfo, err := env.lfo(name)
+	if err != nil {
+		return nil, err
+	}
+	dev, ok := env.devices[device]
+	if !ok {
+		return nil, fmt.Errorf("unknown device: %s", device)
+	}
+	return nil, lfo.Unroute(dev, prop)
+}
+
+// gainCommand sets the gain of the mixer channel of a device, or of a bus or the
+// master, in dB.
+func gainCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device string
+	var gain float64
+	if err := readArgs(args, &device, &gain); err != nil {
+		return nil, err
+	}
+	switch dev := env.devices[device].(type) {
+	case *audio.Master, *audio.Bus:
+		return nil, dev.Set(audio.PropGain, gain)
+	}
+	channel, err := env.channel(device)
+	if err != nil {
+		return nil, err
+	}
+	return nil, channel.Set(audio.PropGain, gain)
+}
+
+func panCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device string
+	var pan float64
+	if err := readArgs(args, &device, &pan); err != nil {
+		return nil, err
+	}
+	channel, err := env.channel(device)
+	if err != nil {
+		return nil, err
+	}
+	return nil, channel.Set(audio.PropPan, pan)
+}
+
+// switchCommand returns a command that turns prop of a mixer channel on or off.
+func switchCommand(prop string, on bool) func(*env, []dub.Node) (dub.Node, error) {
+	return func(env *env, args []dub.Node) (dub.Node, error) {
+		var device string
+		if err := readArgs(args, &device); err != nil {
+			return nil, err
+		}
+		channel, err := env.channel(device)
+		if err != nil {
+			return nil, err
+		}
+		return nil, channel.Set(prop, on)
+	}
+}
+
+func busCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var name string
+	if err := readArgs(args, &name); err != nil {
+		return nil, err
+	}
+	if _, ok := env.devices[name]; ok {
+		return nil, fmt.Errorf("device already exists: %s", name)
+	}
+	env.devices[name] = env.sink.AddBus()
+	return nil, nil
+}
+
+// sendCommand sets the level in dB at which a device is sent to a bus.
+func sendCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device, name string
+	var gain float64
+	if err := readArgs(args, &device, &name, &gain); err != nil {
+		return nil, err
+	}
+	channel, err := env.channel(device)
+	if err != nil {
+		return nil, err
+	}
+	bus, ok := env.devices[name].(*audio.Bus)
+	if !ok {
+		return nil, fmt.Errorf("not a bus: %s", name)
+	}
+	return nil, channel.Send(bus, gain)
+}
+
+// metersCommand lists the peak level of every mixer channel, bus and the master
+// since the meters were last read, and the number of samples that the limiter
+// kept from clipping.
+func metersCommand(env *env, args []dub.Node) (dub.Node, error) {
+	type peaker interface {
+		Peak() float64
+	}
+	var names []string
+	meters := make(map[string]peaker)
+	for name, dev := range env.devices {
+		if bus, ok := dev.(*audio.Bus); ok {
+			meters[name] = bus
+		} else if channel, _ := env.channel(name); channel != nil {
+			meters[name] = channel
+		} else {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		fmt.Fprintf(&b, "%-8s%6.1f dB\n", name, meters[name].Peak())
+	}
+	master := env.sink.Master()
+	fmt.Fprintf(&b, "%-8s%6.1f dB, %d clips", "master", master.Peak(), master.Clips())
+	return dub.String(b.String()), nil
+}
+
+// insertCommand creates an effect and adds it to the insert chain of a device, a
+// bus or the master, at the end or at an optional position.
+func insertCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device, name, kind string
+	if err := readArgs(args[:3], &device, &name, &kind); err != nil {
+		return nil, err
+	}
+	chain, err := env.chain(device)
+	if err != nil {
+		return nil, err
+	}
+	pos := len(chain.Effects())
+	switch len(args) {
+	case 3:
+	case 4:
+		err = readArgs(args[3:], &pos)
+	default:
+		err = errors.New("expected a device, name, effect type and optional position")
+	}
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := env.devices[name]; ok {
+		return nil, fmt.Errorf("device already exists: %s", name)
+	}
+	effect, err := audio.NewEffect(kind, audio.NewProps(), env.sequencer)
+	if err != nil {
+		return nil, err
+	}
+	if err := chain.Insert(pos, effect); err != nil {
+		return nil, err
+	}
+	env.devices[name] = effect
+	return nil, nil
+}
+
+func removeCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device, name string
+	if err := readArgs(args, &device, &name); err != nil {
+		return nil, err
+	}
+	chain, effect, err := env.effect(device, name)
+	if err != nil {
+		return nil, err
+	}
+	if err := chain.Remove(effect); err != nil {
+		return nil, err
+	}
+	delete(env.devices, name)
+	return nil, nil
+}
+
+func moveCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device, name string
+	var pos int
+	if err := readArgs(args, &device, &name, &pos); err != nil {
+		return nil, err
+	}
+	chain, effect, err := env.effect(device, name)
+	if err != nil {
+		return nil, err
+	}
+	return nil, chain.Move(effect, pos)
+}
+
+// chainCommand lists the insert effects of a device in processing order.
+func chainCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var device string
+	if err := readArgs(args, &device); err != nil {
+		return nil, err
+	}
+	chain, err := env.chain(device)
+	if err != nil {
+		return nil, err
+	}
+	names := make(map[audio.Device]string)
+	for name, dev := range env.devices {
+		names[dev] = name
+	}
+	var lines []string
+	for n, effect := range chain.Effects() {
+		lines = append(lines, fmt.Sprintf("%-4d%s", n, names[effect]))
+	}
+	return dub.String(strings.Join(lines, "\n")), nil
+}
+
+// sidechainCommand keys a compressor by the output of a device. Without a
+// device, the compressor follows its own input again.
+func sidechainCommand(env *env, args []dub.Node) (dub.Node, error) {
+	var name, device string
+	var err error
+	switch len(args) {
+	case 1:
+		err = readArgs(args, &name)
+	case 2:
+		err = readArgs(args, &name, &device)
+	default:
+		err = errors.New("expected a compressor and an optional device")
+	}
+	if err != nil {
+		return nil, err
+	}
+	effect, ok := env.devices[name].(audio.Effect)
+	if !ok {
+		return nil, fmt.Errorf("not an effect: %s", name)
+	}
+	var source audio.Source
+	if device != "" {
+		if _, err := env.channel(device); err != nil {
+			return nil, err
+		}
+		source = env.devices[device].(audio.Source)
+	}
+	return nil, env.sink.Sidechain(effect, source)
+}
+
+// chain returns the insert chain of a device, a bus or the master.
+func (e *env) chain(name string) (audio.Chain, error) {
+	switch dev := e.devices[name].(type) {
+	case *audio.Master:
+		return dev.Chain, nil
+	case *audio.Bus:
+		return dev.Chain, nil
+	}
+	channel, err := e.channel(name)
+	if err != nil {
+		return audio.Chain{}, err
+	}
+	return channel.Chain, nil
+}
+
+// effect returns the chain of device and the effect with the given name.
+func (e *env) effect(device, name string) (audio.Chain, audio.Effect, error) {
+	chain, err := e.chain(device)
+	if err != nil {
+		return chain, nil, err
+	}
+	effect, ok := e.devices[name].(audio.Effect)
+	if !ok {
+		return chain, nil, fmt.Errorf("not an effect: %s", name)
+	}
+	return chain, effect, nil
+}
+
+// channel returns the mixer channel of a device.
+func (e *env) channel(name string) (*audio.Channel, error) {
+	dev, ok := e.devices[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown device: %s", name)
+	}
+	source, ok := dev.(audio.Source)
+	if !ok {
+		return nil, fmt.Errorf("device has no audio output: %s", name)
+	}
+	channel := e.sink.Channel(source)
+	if channel == nil {
+		return nil, fmt.Errorf("device is not connected to the mixer: %s", name)
+	}
+	return channel, nil
+}
+
+func (e *env) lfo(name string) (*audio.LFO, error) {
+	dev, ok := e.devices[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown device: %s", name)
+	}
+	lfo, ok := dev.(*audio.LFO)
+	if !ok {
+		return nil, fmt.Errorf("device is not an lfo: %s", name)
+	}
+	return lfo, nil
 }
 
 func loopCommand(env *env, args []dub.Node) (dub.Node, error) {
@@ -180,10 +777,20 @@ func evalPattern(pattern dub.Array, clip *audio.Clip, divLength float64, pos *fl
 		case dub.Number:
 			clip.AddNote(*pos, int(v), noteLength)
 			*pos += noteLength
+		case dub.Note:
+			if err := addNote(clip, v, *pos, noteLength); err != nil {
+				return err
+			}
+			*pos += noteLength
 		case dub.Tuple:
 			for _, item := range v {
-				if i, ok := item.(dub.Number); ok {
-					clip.AddNote(*pos, int(i), noteLength)
+				switch n := item.(type) {
+				case dub.Number:
+					clip.AddNote(*pos, int(n), noteLength)
+				case dub.Note:
+					if err := addNote(clip, n, *pos, noteLength); err != nil {
+						return err
+					}
 				}
 			}
 			*pos += noteLength
@@ -200,6 +807,15 @@ func evalPattern(pattern dub.Array, clip *audio.Clip, divLength float64, pos *fl
 	return nil
 }
 
+// addNote adds a note with a velocity to clip.
+func addNote(clip *audio.Clip, n dub.Note, pos, length float64) error {
+	if n.Velocity < 1 || n.Velocity > 127 {
+		return fmt.Errorf("velocity must be between 1 and 127: %v", n.Velocity)
+	}
+	clip.AddNoteVelocity(pos, int(n.Pitch), int(n.Velocity), length)
+	return nil
+}
+
 func readArgs(args []dub.Node, slots ...interface{}) error {
 	if len(args) != len(slots) {
 		return errors.New("not enough arguments")